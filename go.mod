@@ -4,7 +4,9 @@ go 1.21
 
 require (
 	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/sys v0.10.0
 	google.golang.org/grpc v1.58.3
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/kubelet v0.28.2
 )
 
@@ -12,7 +14,6 @@ require (
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	golang.org/x/net v0.13.0 // indirect
-	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.11.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20230711160842-782d3b101e98 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
@@ -2,30 +2,111 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/config"
+	"hailo-device-plugin/pkg/hook"
 	"hailo-device-plugin/pkg/monitor"
+	"hailo-device-plugin/pkg/plugin"
 	"hailo-device-plugin/pkg/statemachine"
 )
 
-const (
-	kubeletSocket = "/var/lib/kubelet/device-plugins/kubelet.sock"
-	pluginSocket  = "/var/lib/kubelet/device-plugins/hailo.sock"
-	resourceName  = "hailo.ai/npu"
-	cdiDir        = "/etc/cdi"
-)
+// kubeletVersionTimeout bounds reading the node object at startup
+const kubeletVersionTimeout = 10 * time.Second
 
 func main() {
+	// The runtime runs the binary installed on the host as CDI hook
+	if len(os.Args) > 1 && os.Args[1] == hook.Command {
+		os.Exit(hook.Main(os.Args[2:], os.Stdin, os.Stderr))
+	}
+
+	cfg, opts, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if opts.Print {
+		data, err := cfg.YAML()
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	log.Println("Starting Hailo device plugin...")
+	if opts.Path != "" {
+		log.Printf("Using configuration file %s", opts.Path)
+	}
+
+	discoverer, err := monitor.NewDiscoverer(strings.Join(cfg.Discovery.Backends, ","), monitor.DiscovererOptions{
+		SysfsRoot:      monitor.DefaultSysfsRoot,
+		HailortcliPath: cfg.Discovery.Hailortcli,
+		StaticPath:     cfg.Discovery.StaticDevices,
+	})
+	if err != nil {
+		log.Fatalf("Invalid discovery configuration: %v", err)
+	}
+	log.Printf("Using device discovery: %s", discoverer.Name())
+
+	mode, err := plugin.ParseAllocationMode(cfg.Plugin.AllocationMode)
+	if err != nil {
+		log.Fatalf("Invalid allocation mode: %v", err)
+	}
+	kubeletVersion := cfg.Kubelet.Version
+	if mode == plugin.AllocationModeAuto && kubeletVersion == "" {
+		kubeletVersion = detectKubeletVersion(cfg.Kubelet.NodeName)
+	}
+	mode = plugin.ResolveAllocationMode(mode, kubeletVersion)
+	log.Printf("Using allocation mode: %s (kubelet version %q)", mode, kubeletVersion)
+
+	env, err := cdi.ParseEnvTemplates(cfg.CDI.GlobalEnv, cfg.CDI.DeviceEnv)
+	if err != nil {
+		log.Fatalf("Invalid CDI env templates: %v", err)
+	}
+	generator := cdi.NewGenerator(monitor.DefaultDevRoot, monitor.DefaultSysfsRoot)
+	generator.Env = env
+	if generator.Groups, err = cdi.ParseGroups(strings.Join(cfg.CDI.Groups, ",")); err != nil {
+		log.Fatalf("Invalid CDI device groups: %v", err)
+	}
+	generator.SwitchGroups = cfg.CDI.SwitchGroups
+	// Inside a container the host is only reachable through a mount
+	if info, err := os.Stat(cfg.CDI.HostRoot); err != nil || !info.IsDir() {
+		log.Fatalf("Host root %s is not a directory, mount the host filesystem and set --host-root: %v", cfg.CDI.HostRoot, err)
+	}
+	generator.HostRoot = cfg.CDI.HostRoot
+	if !cfg.CDI.Injection.IsEmpty() {
+		generator.Injection = &cfg.CDI.Injection
+	}
 
 	// Create CDI directory
-	if err := os.MkdirAll(cdiDir, 0755); err != nil {
+	if err := os.MkdirAll(cfg.CDI.Dir, 0755); err != nil {
 		log.Fatalf("Failed to create CDI directory: %v", err)
 	}
 
+	// The spec references the hook binary, so it must exist before the monitor writes one
+	if err := installHookBinary(hook.DefaultBinary); err != nil {
+		log.Fatalf("Failed to install CDI hook binary: %v", err)
+	}
+	if err := installCleanupScript(hook.DefaultRoot); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -34,21 +115,67 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
+	health := monitor.NewHealthChecker(monitor.DefaultSysfsRoot, monitor.DefaultDevRoot)
+	health.Probe = cfg.Health.Probe
+	health.ProbeTimeout = cfg.Health.ProbeTimeout
+
 	// Start resource monitor
-	mon := monitor.NewResourceMonitor(cdiDir)
+	mon := monitor.NewResourceMonitor(&monitor.Config{
+		CdiDir:     cfg.CDI.Dir,
+		SpecDirs:   cfg.CDI.SpecDirs,
+		Discoverer: discoverer,
+		Health:     health,
+		Tracker:    monitor.NewHealthTracker(cfg.Health.FailureThreshold, cfg.Health.SuccessThreshold),
+		StatusFile: cfg.Health.StatusFile,
+		Generator:  generator,
+		Intervals: monitor.Intervals{
+			Resync:        cfg.Discovery.ResyncInterval,
+			HotplugSettle: cfg.Discovery.HotplugSettle,
+			Health:        cfg.Health.Interval,
+		},
+	})
 	mon.Start(ctx)
 	log.Println("Resource monitor started")
 
 	// Create state machine configuration
-	config := &statemachine.Config{
-		KubeletSocket: kubeletSocket,
-		PluginSocket:  pluginSocket,
-		ResourceName:  resourceName,
-		CdiDir:        cdiDir,
+	smConfig := &statemachine.Config{
+		KubeletSocket:  cfg.Kubelet.Socket,
+		PluginSocket:   cfg.Plugin.Socket,
+		ResourceName:   cfg.Plugin.ResourceName,
+		CdiDir:         cfg.CDI.Dir,
+		SpecDirs:       cfg.CDI.SpecDirs,
+		AllocationMode: mode,
+		Generator:      generator,
+		Replicas: plugin.Replicas{
+			Default:  cfg.Sharing.Replicas.Default,
+			PerModel: cfg.Sharing.Replicas.Models,
+		},
+		ServiceProbeInterval: cfg.Sharing.ServiceProbeInterval,
+		RegisterRetries:      cfg.Plugin.RegisterRetries,
+		Registration: plugin.Registration{
+			KubeletSocket: cfg.Kubelet.Socket,
+			Timeout:       cfg.Plugin.RegisterTimeout,
+			Backoff:       cfg.Plugin.RegisterBackoff,
+		},
+		ServerStartDelay: cfg.Plugin.ServerStartDelay,
+		RestartInterval:  cfg.Plugin.RestartInterval,
+	}
+	if len(cfg.Plugin.ModelResources) > 0 {
+		smConfig.Resources = statemachine.ModelResources(cfg.Plugin.ResourceName, cfg.Plugin.Socket, cfg.Plugin.ModelResources)
+	}
+	if cfg.Sharing.HailortService {
+		smConfig.Service = &plugin.HailortService{Socket: cfg.Sharing.ServiceSocket, HostRoot: cfg.CDI.HostRoot}
+		if smConfig.Replicas.Default == 0 && len(smConfig.Replicas.PerModel) == 0 {
+			smConfig.Replicas.Default = plugin.DefaultServiceSlots
+		}
+		log.Printf("Sharing devices through hailort_service at %s (host root %s)", cfg.Sharing.ServiceSocket, cfg.CDI.HostRoot)
+		if err := smConfig.Service.Probe(); err != nil {
+			log.Printf("Warning: shared slots stay unhealthy until hailort_service is reachable below host root %s: %v", cfg.CDI.HostRoot, err)
+		}
 	}
 
 	// Create and start state machine
-	sm := statemachine.New(ctx, config)
+	sm := statemachine.New(ctx, smConfig)
 
 	// Handle shutdown signal in a goroutine
 	go func() {
@@ -64,3 +191,60 @@ func main() {
 
 	log.Println("Hailo device plugin exited successfully")
 }
+
+// installHookBinary copies the running executable to path on the host, for the
+// runtime to run as CDI hook. The copy is atomic, so a hook running during a
+// plugin upgrade never sees a partial binary.
+func installHookBinary(path string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		return fmt.Errorf("failed to read executable: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if _, err := cdi.WriteFileIfChanged(path, data, 0755); err != nil {
+		return fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	return nil
+}
+
+// cleanupScript is the poststop hook of specs from earlier releases, which
+// bound the shared empty-chardev directory. Containers started with them
+// still run it when they stop, so it stays installed.
+const cleanupScript = `#!/bin/sh
+# Cleanup script to remove all files from empty-chardev directory
+rm -rf /var/lib/hailo-cdi/empty-chardev/*
+exit 0
+`
+
+// installCleanupScript writes cleanupScript next to the hook binary
+func installCleanupScript(root string) error {
+	path := filepath.Join(root, "cleanup-empty-chardev.sh")
+	if _, err := cdi.WriteFileIfChanged(path, []byte(cleanupScript), 0755); err != nil {
+		return fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	return nil
+}
+
+// detectKubeletVersion reads the kubelet version from the node object,
+// returning "" when it cannot be read
+func detectKubeletVersion(nodeName string) string {
+	if nodeName == "" {
+		log.Println("Kubelet version unknown: set --kubelet-version or --node-name for --allocation-mode=auto")
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kubeletVersionTimeout)
+	defer cancel()
+	version, err := plugin.NodeKubeletVersion(ctx, nodeName)
+	if err != nil {
+		log.Printf("Failed to read the kubelet version of node %s, set --kubelet-version: %v", nodeName, err)
+		return ""
+	}
+	log.Printf("Detected kubelet version %s on node %s", version, nodeName)
+	return version
+}
@@ -1,66 +1,78 @@
 package cdi
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/hook"
 )
 
-// CDISpec represents a basic CDI spec structure
-type CDISpec struct {
-	Version        string            `json:"cdiVersion"`
-	Kind           string            `json:"kind"`
-	Annotations    map[string]string `json:"annotations,omitempty"`
-	Devices        []*DeviceSpec     `json:"devices"`
-	ContainerEdits *ContainerEdits   `json:"containerEdits,omitempty"`
-}
+// Kind is the CDI vendor/class of all Hailo devices
+const Kind = "hailo.ai/npu"
 
-// DeviceSpec represents a device in CDI
-type DeviceSpec struct {
-	Name           string            `json:"name"`
-	Annotations    map[string]string `json:"annotations,omitempty"`
-	ContainerEdits ContainerEdits    `json:"containerEdits"`
+// QualifiedName returns the fully qualified CDI name of a device, e.g. hailo.ai/npu=hailo0
+func QualifiedName(deviceName string) string {
+	return Kind + "=" + deviceName
 }
 
-// ContainerEdits for CDI
-type ContainerEdits struct {
-	Env         []string      `json:"env,omitempty"`
-	DeviceNodes []*DeviceNode `json:"deviceNodes,omitempty"`
-	Mounts      []*Mount      `json:"mounts,omitempty"`
-	Hooks       []*Hook       `json:"hooks,omitempty"`
-}
+// ChardevClassPath is the sysfs class directory listing the Hailo char devices
+const ChardevClassPath = "/sys/class/hailo_chardev"
 
-// DeviceNode for CDI
-type DeviceNode struct {
-	Path        string `json:"path"`
-	HostPath    string `json:"hostPath,omitempty"`
-	Type        string `json:"type,omitempty"`
-	Major       int    `json:"major,omitempty"`
-	Minor       int    `json:"minor,omitempty"`
-	Permissions string `json:"permissions,omitempty"`
-}
+const (
+	// DefaultDevRoot is where device nodes are inspected
+	DefaultDevRoot = "/dev"
+	// DefaultSysfsRoot is where per-device sysfs entries are looked up
+	DefaultSysfsRoot = "/sys"
 
-// Mount for CDI
-type Mount struct {
-	HostPath      string   `json:"hostPath"`
-	ContainerPath string   `json:"containerPath"`
-	Options       []string `json:"options,omitempty"`
-}
+	// hookTimeout is the timeout of the CDI hooks in seconds
+	hookTimeout = 5
+)
 
-// Hook for CDI lifecycle hooks
-type Hook struct {
-	HookName string   `json:"hookName"`
-	Path     string   `json:"path"`
-	Args     []string `json:"args,omitempty"`
-	Env      []string `json:"env,omitempty"`
-	Timeout  int      `json:"timeout,omitempty"`
+// Generator renders CDI specs from discovered devices
+type Generator struct {
+	// DevRoot is where device nodes are inspected, the spec keeps the host paths
+	DevRoot string
+	// SysfsRoot is where per-device sysfs entries are looked up
+	SysfsRoot string
+	// Env.Device is rendered into the per-device container edits, Env.Global
+	// is left to the plugin, which renders it per allocation
+	Env EnvTemplates
+	// HookPath is the host path of the plugin binary run as CDI hook
+	HookPath string
+	// Groups are emitted as composite devices next to the all device
+	Groups []DeviceGroup
+	// SwitchGroups adds a composite device per PCIe switch with several devices behind it
+	SwitchGroups bool
+	// Injection bind-mounts host HailoRT files into every container, optional
+	Injection *Injection
+	// HostRoot is where the host filesystem is visible to resolve injection paths
+	HostRoot string
 }
 
+// NewGenerator creates a generator, empty roots default to /dev and /sys
+func NewGenerator(devRoot, sysfsRoot string) *Generator {
+	if devRoot == "" {
+		devRoot = DefaultDevRoot
+	}
+	if sysfsRoot == "" {
+		sysfsRoot = DefaultSysfsRoot
+	}
+	return &Generator{
+		DevRoot:   devRoot,
+		SysfsRoot: sysfsRoot,
+		Env:       defaultEnvTemplates(),
+		HookPath:  hook.DefaultBinary,
+		HostRoot:  "/",
+	}
+}
 
 // resolveSysfsPath verifies that the device path exists
-func resolveSysfsPath(deviceID string) error {
-	symlinkPath := filepath.Join("/sys/class/hailo_chardev", deviceID)
+func (g *Generator) resolveSysfsPath(deviceID string) error {
+	symlinkPath := filepath.Join(g.SysfsRoot, "class", "hailo_chardev", deviceID)
 
 	// Verify the symlink exists
 	_, err := os.Stat(symlinkPath)
@@ -73,19 +85,19 @@ func resolveSysfsPath(deviceID string) error {
 
 // createDeviceSpecificSysfsMounts creates mount configurations for device-specific sysfs
 // This ensures the container only sees the assigned Hailo device in /sys/class/hailo_chardev/
-func createDeviceSpecificSysfsMounts(deviceID string) ([]*Mount, error) {
-	err := resolveSysfsPath(deviceID)
+func (g *Generator) createDeviceSpecificSysfsMounts(deviceID string) ([]*Mount, error) {
+	err := g.resolveSysfsPath(deviceID)
 	if err != nil {
 		return nil, err
 	}
 
 	mounts := []*Mount{
 		// Mount only the specific device into /sys/class/hailo_chardev/<deviceID>
-		// The parent directory (/sys/class/hailo_chardev) is already mounted as empty
+		// The parent directory (/sys/class/hailo_chardev) is already a private tmpfs
 		// from the global containerEdits, so this will overlay just this device
 		{
-			HostPath:      fmt.Sprintf("/sys/class/hailo_chardev/%s", deviceID),
-			ContainerPath: fmt.Sprintf("/sys/class/hailo_chardev/%s", deviceID),
+			HostPath:      ChardevClassPath + "/" + deviceID,
+			ContainerPath: ChardevClassPath + "/" + deviceID,
 			Options:       []string{"ro", "bind"},
 		},
 	}
@@ -94,12 +106,50 @@ func createDeviceSpecificSysfsMounts(deviceID string) ([]*Mount, error) {
 }
 
 // GenerateCDI creates a CDI spec file for Hailo devices
-// 모니터가 호출, 매 10초마다 디바이스를 발견해서 CDI 스펙을 생성
-func GenerateCDI(devices []string, outputDir string) error {
+// 모니터가 호출, 디바이스를 발견할 때마다 CDI 스펙을 생성
+// The file is replaced atomically and left untouched when the rendered spec is
+// unchanged, so runtimes never read a partial spec and can keep their cache.
+func GenerateCDI(devices []device.Device, outputDir string) (bool, error) {
+	return NewGenerator("", "").Generate(devices, outputDir)
+}
 
-	spec := CDISpec{
-		Version: "0.6.0",
-		Kind:    "hailo.ai/npu",
+// Generate writes the spec for devices to hailo.json in outputDir, see GenerateCDI
+func (g *Generator) Generate(devices []device.Device, outputDir string) (bool, error) {
+	spec := g.BuildSpec(devices)
+	if err := Validate(spec); err != nil {
+		return false, fmt.Errorf("generated spec is invalid: %w", err)
+	}
+
+	data, err := MarshalSpec(spec)
+	if err != nil {
+		return false, err
+	}
+
+	cdiFile := filepath.Join(outputDir, "hailo.json")
+	return WriteFileIfChanged(cdiFile, data, 0644)
+}
+
+// BuildSpec renders the CDI spec for the given devices with the default roots.
+// The plugin's legacy allocation mode uses the same spec, so both paths give
+// containers the same view.
+func BuildSpec(devices []device.Device) *CDISpec {
+	return NewGenerator("", "").BuildSpec(devices)
+}
+
+// Model returns the model of a device, detecting it when discovery left it
+// empty. Unknown models render as "" and are left out of the spec.
+func Model(dev device.Device) string {
+	if dev.Model != "" {
+		return dev.Model
+	}
+	return device.DetectModel(dev)
+}
+
+// BuildSpec renders the CDI spec for the given devices. Devices whose node
+// exists but is not a character device are left out.
+func (g *Generator) BuildSpec(devices []device.Device) *CDISpec {
+	spec := &CDISpec{
+		Kind: Kind,
 		Annotations: map[string]string{
 			"vendor":       "Hailo Technologies",
 			"description":  "Hailo NPU devices for AI inference acceleration",
@@ -110,19 +160,13 @@ func GenerateCDI(devices []string, outputDir string) error {
 		ContainerEdits: &ContainerEdits{
 			Mounts: []*Mount{
 				{
-					// Mount empty directory to /sys/class/hailo_chardev with rw
-					// This hides all devices initially and allows mounting devices inside
-					HostPath:      "/var/lib/hailo-cdi/empty-chardev",
-					ContainerPath: "/sys/class/hailo_chardev",
-					Options:       []string{"rw", "bind"},
-				},
-			},
-			Hooks: []*Hook{
-				{
-					HookName: "poststop",
-					Path:     "/var/lib/hailo-cdi/cleanup-empty-chardev.sh",
-					Args:     []string{},
-					Timeout:  5,
+					// Mount a private tmpfs over /sys/class/hailo_chardev
+					// This hides all devices initially and gives every container its
+					// own directory for the device mountpoints, nothing is shared
+					HostPath:      "tmpfs",
+					ContainerPath: ChardevClassPath,
+					Type:          "tmpfs",
+					Options:       []string{"nosuid", "nodev", "noexec", "mode=0755", "size=64k"},
 				},
 			},
 		},
@@ -130,60 +174,118 @@ func GenerateCDI(devices []string, outputDir string) error {
 
 	// Individual devices
 	for _, dev := range devices {
+		node, err := g.deviceNode(dev)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: leaving %s out of the CDI spec: %v\n", dev.Name, err)
+			continue
+		}
+
 		// Create device-specific sysfs mounts to isolate this device
-		sysfsMounts, err := createDeviceSpecificSysfsMounts(dev)
+		sysfsMounts, err := g.createDeviceSpecificSysfsMounts(dev.Name)
 		if err != nil {
 			// Log warning but continue - device will still work without sysfs isolation
-			fmt.Fprintf(os.Stderr, "Warning: failed to create sysfs mounts for %s: %v\n", dev, err)
+			fmt.Fprintf(os.Stderr, "Warning: failed to create sysfs mounts for %s: %v\n", dev.Name, err)
 			sysfsMounts = []*Mount{}
 		}
 
+		env, err := renderEnv(g.Env.Device, deviceEnvData{Device: dev, Model: Model(dev)})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to render env for %s: %v\n", dev.Name, err)
+		}
+
+		pciSlot := dev.PCIAddress
+		if pciSlot == "" {
+			pciSlot = "auto-detect"
+		}
+
+		annotations := map[string]string{
+			"device.type": "npu",
+			"pci.slot":    pciSlot,
+		}
+		if model := Model(dev); model != "" {
+			annotations["device.model"] = model
+		}
+
 		spec.Devices = append(spec.Devices, &DeviceSpec{
-			Name: dev,
-			Annotations: map[string]string{
-				"device.type":  "npu",
-				"device.model": "hailo-8",
-				"pci.slot":     "auto-detect",
-			},
+			Name:        dev.Name,
+			Annotations: annotations,
 			ContainerEdits: ContainerEdits{
-				DeviceNodes: []*DeviceNode{
-					{
-						Path:        fmt.Sprintf("/dev/%s", dev),
-						HostPath:    fmt.Sprintf("/dev/%s", dev),
-						Type:        "c",
-						Permissions: "rw",
-					},
-				},
-				Mounts: sysfsMounts,
+				Env:         env,
+				DeviceNodes: []*DeviceNode{node},
+				Mounts:      sysfsMounts,
 			},
 		})
 	}
 
-	data, err := json.MarshalIndent(spec, "", "  ")
-	if err != nil {
-		return err
-	}
+	// Global env depends on the allocation, so the plugin renders it in Allocate
 
-	cdiFile := filepath.Join(outputDir, "hailo.json")
-	return os.WriteFile(cdiFile, data, 0644)
+	mounts, hooks := g.injectionEdits()
+	spec.ContainerEdits.Mounts = append(spec.ContainerEdits.Mounts, mounts...)
+	spec.ContainerEdits.Hooks = append(spec.ContainerEdits.Hooks, hooks...)
+
+	g.addGroups(spec, devices)
+
+	// Declare the oldest version that can express the spec, so older runtimes can still read it
+	spec.Version = MinimumVersion(spec)
+	return spec
 }
 
-// ReadDevices reads the CDI spec and returns the list of device IDs
-func ReadDevices(cdiDir string) ([]string, error) {
-	cdiFile := filepath.Join(cdiDir, "hailo.json")
-	data, err := os.ReadFile(cdiFile)
+// deviceNode describes the device's char node with the numbers, mode and
+// ownership found on the host, so runtimes that do not stat host paths still
+// create a correct node. A missing node falls back to the numbers read from
+// sysfs during discovery.
+func (g *Generator) deviceNode(dev device.Device) (*DeviceNode, error) {
+	node := &DeviceNode{
+		Path:        dev.DevPath,
+		HostPath:    dev.DevPath,
+		Type:        "c",
+		Permissions: "rw",
+	}
+
+	path := filepath.Join(g.DevRoot, strings.TrimPrefix(dev.DevPath, DefaultDevRoot+"/"))
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if dev.Major != 0 {
+			major, minor := int64(dev.Major), int64(dev.Minor)
+			node.Major, node.Minor = &major, &minor
+		}
+		return node, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var spec CDISpec
-	if err := json.Unmarshal(data, &spec); err != nil {
-		return nil, err
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("%s is not a character device (mode %s)", path, info.Mode())
+	}
+
+	stat, ok := statNode(info)
+	if !ok {
+		return node, nil
 	}
+	mode := info.Mode().Perm()
+	node.Major, node.Minor = &stat.major, &stat.minor
+	node.FileMode = &mode
+	node.UID, node.GID = &stat.uid, &stat.gid
+	return node, nil
+}
 
-	var devices []string
-	for _, dev := range spec.Devices {
-		devices = append(devices, dev.Name)
+// ReadDevices loads the Hailo specs of the given directories, in increasing
+// priority, and returns the device IDs, leaving out the all device and device
+// groups. Conflicting and unreadable specs are reported as warnings.
+func ReadDevices(cdiDirs ...string) ([]string, error) {
+	set, err := LoadSpecs(cdiDirs)
+	if err != nil {
+		return nil, err
+	}
+	for path, err := range set.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: skipping CDI spec %s: %v\n", path, err)
+	}
+	for _, conflict := range set.Conflicts {
+		fmt.Fprintf(os.Stderr, "Warning: CDI conflict: %s\n", conflict)
+	}
+	if len(set.Specs) == 0 {
+		return nil, fmt.Errorf("no %s spec found in %s", Kind, strings.Join(cdiDirs, ", "))
 	}
-	return devices, nil
+	return set.DeviceNames(), nil
 }
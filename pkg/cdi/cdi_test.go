@@ -0,0 +1,238 @@
+package cdi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+func TestGenerateCDI_SkipsUnchangedSpec(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hailo.json")
+	devices := []device.Device{device.New("hailo0")}
+
+	written, err := GenerateCDI(devices, dir)
+	if err != nil || !written {
+		t.Fatalf("Expected first generation to write the spec: written=%v err=%v", written, err)
+	}
+
+	// Backdate the file so an unexpected rewrite would be visible
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	written, err = GenerateCDI(devices, dir)
+	if err != nil || written {
+		t.Fatalf("Expected identical spec to be skipped: written=%v err=%v", written, err)
+	}
+	if info, _ := os.Stat(path); !info.ModTime().Equal(old) {
+		t.Error("Spec file was rewritten although unchanged")
+	}
+
+	written, err = GenerateCDI(append(devices, device.New("hailo1")), dir)
+	if err != nil || !written {
+		t.Fatalf("Expected changed device set to be written: written=%v err=%v", written, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only hailo.json in the CDI dir, got %d entries", len(entries))
+	}
+}
+
+func TestMarshalSpec_HashAnnotation(t *testing.T) {
+	one, err := MarshalSpec(BuildSpec([]device.Device{device.New("hailo0")}))
+	if err != nil {
+		t.Fatalf("MarshalSpec failed: %v", err)
+	}
+	two, _ := MarshalSpec(BuildSpec([]device.Device{device.New("hailo0"), device.New("hailo1")}))
+
+	hashOf := func(data []byte) string {
+		var spec CDISpec
+		if err := json.Unmarshal(data, &spec); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		return spec.Annotations[SpecHashAnnotation]
+	}
+
+	if h := hashOf(one); !strings.HasPrefix(h, "sha256:") {
+		t.Errorf("Unexpected hash annotation %q", h)
+	}
+	if hashOf(one) == hashOf(two) {
+		t.Error("Expected different specs to have different hashes")
+	}
+
+	// Re-marshalling a spec read back from disk must be stable
+	var spec CDISpec
+	json.Unmarshal(one, &spec)
+	again, _ := MarshalSpec(&spec)
+	if string(again) != string(one) {
+		t.Error("Expected re-marshalled spec to be byte-identical")
+	}
+}
+
+func TestGenerator_DeviceNodes(t *testing.T) {
+	null, err := os.Stat("/dev/null")
+	if err != nil || null.Mode()&os.ModeCharDevice == 0 {
+		t.Skip("/dev/null is not a character device here")
+	}
+
+	devRoot := t.TempDir()
+	// /dev/null stands in for a real Hailo char device
+	if err := os.Symlink("/dev/null", filepath.Join(devRoot, "hailo0")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(devRoot, "hailo1"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	unplugged := device.New("hailo2")
+	unplugged.Major, unplugged.Minor = 507, 2
+
+	generator := NewGenerator(devRoot, t.TempDir())
+	spec := generator.BuildSpec([]device.Device{device.New("hailo0"), device.New("hailo1"), unplugged})
+
+	// The all device follows the two emitted devices
+	if len(spec.Devices) != 3 || spec.Devices[0].Name != "hailo0" || spec.Devices[1].Name != "hailo2" {
+		t.Fatalf("Expected the regular file hailo1 to be left out, got %d devices", len(spec.Devices))
+	}
+
+	node := spec.Devices[0].ContainerEdits.DeviceNodes[0]
+	if node.HostPath != "/dev/hailo0" || node.Major == nil || *node.Major != 1 || *node.Minor != 3 {
+		t.Errorf("Expected /dev/hailo0 with the numbers of /dev/null, got %+v", node)
+	}
+	if node.FileMode == nil || *node.FileMode != null.Mode().Perm() || node.UID == nil || node.GID == nil {
+		t.Errorf("Expected file mode and ownership to be filled in, got %+v", node)
+	}
+
+	missing := spec.Devices[1].ContainerEdits.DeviceNodes[0]
+	if missing.Major == nil || *missing.Major != 507 || *missing.Minor != 2 || missing.FileMode != nil {
+		t.Errorf("Expected sysfs numbers for a missing node, got %+v", missing)
+	}
+}
+
+func TestGenerator_Env(t *testing.T) {
+	env, err := ParseEnvTemplates([]string{"HAILO_DEVICE_COUNT={{.Count}}"}, DefaultDeviceEnv)
+	if err != nil {
+		t.Fatalf("ParseEnvTemplates failed: %v", err)
+	}
+
+	dev := device.New("hailo1")
+	dev.PCIAddress = "0000:02:00.0"
+	dev.Architecture = "HAILO8L"
+
+	generator := NewGenerator(t.TempDir(), t.TempDir())
+	generator.Env = env
+	spec := generator.BuildSpec([]device.Device{device.New("hailo0"), dev})
+
+	// Global env depends on the allocation and is left to the plugin
+	if got := spec.ContainerEdits.Env; len(got) != 0 {
+		t.Errorf("Expected no global env in the spec, got %v", got)
+	}
+	if got, err := env.RenderGlobal([]device.Device{dev}); err != nil || !reflect.DeepEqual(got, []string{"HAILO_DEVICE_COUNT=1"}) {
+		t.Errorf("Expected the count of the allocated devices, got %v, %v", got, err)
+	}
+
+	expected := []string{
+		"HAILO_DEVICE_ID=1",
+		"HAILO_PRIMARY_DEVICE=/dev/hailo1",
+		"HAILO_PCI_BDF=0000:02:00.0",
+		"HAILO_DEVICE_MODEL=hailo8l",
+	}
+	if got := spec.Devices[1].ContainerEdits.Env; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v (empty firmware version left out), got %v", expected, got)
+	}
+}
+
+func TestParseEnvTemplates_Invalid(t *testing.T) {
+	for _, entry := range []string{"NO_VALUE", "=x", "BAD={{.Index", "UNKNOWN={{.Nope}}"} {
+		if _, err := ParseEnvTemplates(nil, []string{entry}); err == nil {
+			t.Errorf("Expected error for %q", entry)
+		}
+	}
+}
+
+func TestGenerator_Groups(t *testing.T) {
+	devices := make([]device.Device, 4)
+	for i := range devices {
+		devices[i] = device.New("hailo" + strconv.Itoa(i))
+	}
+	// hailo0 and hailo1 sit behind one switch, hailo2 behind another port of the root complex
+	devices[0].PCIPath = []string{"0000:00:01.0", "0000:01:00.0", "0000:02:01.0"}
+	devices[1].PCIPath = []string{"0000:00:01.0", "0000:01:00.0", "0000:02:02.0"}
+	devices[2].PCIPath = []string{"0000:00:02.0"}
+
+	groups, err := ParseGroups("pair=hailo2+hailo3,ghost=hailo9")
+	if err != nil {
+		t.Fatalf("ParseGroups failed: %v", err)
+	}
+	generator := NewGenerator(t.TempDir(), t.TempDir())
+	generator.Groups = groups
+	generator.SwitchGroups = true
+
+	spec := generator.BuildSpec(devices)
+	if err := Validate(spec); err != nil {
+		t.Fatalf("Spec with groups does not validate: %v", err)
+	}
+
+	members := make(map[string]string)
+	for _, d := range spec.Devices {
+		if IsComposite(d) {
+			members[d.Name] = d.Annotations[MembersAnnotation]
+		}
+	}
+	expected := map[string]string{
+		"all":                      "hailo0,hailo1,hailo2,hailo3",
+		"pair":                     "hailo2,hailo3",
+		"pcie-switch-0000:01:00.0": "hailo0,hailo1",
+	}
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected composite devices %v, got %v", expected, members)
+	}
+
+	all := spec.Devices[4]
+	if all.Name != "all" || len(all.ContainerEdits.DeviceNodes) != 4 {
+		t.Errorf("Expected the all device to hold every device node, got %+v", all)
+	}
+
+	dir := t.TempDir()
+	if _, err := generator.Generate(devices, dir); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	names, err := ReadDevices(dir)
+	if err != nil {
+		t.Fatalf("ReadDevices failed: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"hailo0", "hailo1", "hailo2", "hailo3"}) {
+		t.Errorf("Expected composite devices to be kept out of the inventory, got %v", names)
+	}
+}
+
+func TestParseGroups_Invalid(t *testing.T) {
+	for _, value := range []string{"pair", "pair=", "all=hailo0", "bad/name=hailo0"} {
+		if _, err := ParseGroups(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestBuildSpec_IsolatesWithoutHooks(t *testing.T) {
+	spec := BuildSpec([]device.Device{device.New("hailo0")})
+
+	// The private tmpfs isolates containers, no hook has to run for it
+	if len(spec.ContainerEdits.Hooks) != 0 {
+		t.Errorf("Expected no hooks without injection, got %+v", spec.ContainerEdits.Hooks)
+	}
+	mounts := spec.ContainerEdits.Mounts
+	if len(mounts) != 1 || mounts[0].ContainerPath != ChardevClassPath || mounts[0].Type != "tmpfs" {
+		t.Errorf("Expected a tmpfs over %s, got %+v", ChardevClassPath, mounts)
+	}
+}
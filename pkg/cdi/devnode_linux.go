@@ -0,0 +1,29 @@
+package cdi
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// nodeStat holds the device numbers and ownership of a device node
+type nodeStat struct {
+	major, minor int64
+	uid, gid     uint32
+}
+
+// statNode extracts the device numbers and ownership from a stat result
+func statNode(info os.FileInfo) (nodeStat, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nodeStat{}, false
+	}
+	rdev := uint64(st.Rdev)
+	return nodeStat{
+		major: int64(unix.Major(rdev)),
+		minor: int64(unix.Minor(rdev)),
+		uid:   st.Uid,
+		gid:   st.Gid,
+	}, true
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package cdi
+
+import "os"
+
+// nodeStat holds the device numbers and ownership of a device node
+type nodeStat struct {
+	major, minor int64
+	uid, gid     uint32
+}
+
+// statNode is only available on Linux, elsewhere runtimes stat the node themselves
+func statNode(os.FileInfo) (nodeStat, bool) {
+	return nodeStat{}, false
+}
@@ -0,0 +1,121 @@
+package cdi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// DefaultDeviceEnv are the per-device env templates HailoRT containers expect
+var DefaultDeviceEnv = []string{
+	"HAILO_DEVICE_ID={{.Index}}",
+	"HAILO_PRIMARY_DEVICE={{.DevPath}}",
+	"HAILO_PCI_BDF={{.PCIAddress}}",
+	"HAILO_DEVICE_MODEL={{.Model}}",
+	"HAILO_FW_VERSION={{.FirmwareVersion}}",
+}
+
+// EnvTemplates are KEY=VALUE entries whose value is a text/template. Global
+// entries see the count and names of the devices allocated to a container and
+// are rendered per allocation by the plugin, device entries see one device and
+// are part of the spec. Entries rendering to an empty value are left out.
+type EnvTemplates struct {
+	Global []*template.Template
+	Device []*template.Template
+}
+
+// globalEnvData is the data of global env templates, covering one allocation
+type globalEnvData struct {
+	Count int
+	Names string
+}
+
+// deviceEnvData is the data of per-device env templates
+type deviceEnvData struct {
+	device.Device
+	Model string
+}
+
+// ParseEnvTemplates parses global and per-device env templates
+func ParseEnvTemplates(global, perDevice []string) (EnvTemplates, error) {
+	var env EnvTemplates
+	var err error
+	if env.Global, err = parseEnv(global); err != nil {
+		return env, err
+	}
+	if env.Device, err = parseEnv(perDevice); err != nil {
+		return env, err
+	}
+
+	// Catch references to unknown fields at startup rather than on every rescan
+	if _, err := renderEnv(env.Global, globalEnvData{}); err != nil {
+		return env, err
+	}
+	if _, err := renderEnv(env.Device, deviceEnvData{}); err != nil {
+		return env, err
+	}
+	return env, nil
+}
+
+// RenderGlobal renders the global templates for the devices allocated to one container
+func (e EnvTemplates) RenderGlobal(devices []device.Device) ([]string, error) {
+	return renderEnv(e.Global, globalEnvData{Count: len(devices), Names: strings.Join(device.Names(devices), ",")})
+}
+
+// defaultEnvTemplates parses DefaultDeviceEnv, which is known to be valid
+func defaultEnvTemplates() EnvTemplates {
+	env, err := ParseEnvTemplates(nil, DefaultDeviceEnv)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}
+
+func parseEnv(entries []string) ([]*template.Template, error) {
+	templates := make([]*template.Template, 0, len(entries))
+	for _, entry := range entries {
+		key, _, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env template %q, expected KEY=VALUE", entry)
+		}
+		t, err := template.New(key).Option("missingkey=error").Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env template %q: %w", entry, err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// renderEnv executes templates against data, dropping entries with an empty value
+func renderEnv(templates []*template.Template, data interface{}) ([]string, error) {
+	var env []string
+	for _, t := range templates {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("env %s: %w", t.Name(), err)
+		}
+		if _, value, _ := strings.Cut(buf.String(), "="); value != "" {
+			env = append(env, buf.String())
+		}
+	}
+	return env, nil
+}
+
+// VisibleDevices returns the HAILO_VISIBLE_DEVICES value for a set of devices:
+// their PCI addresses, which HailoRT accepts as device IDs, or the device node
+// of devices without a known address
+func VisibleDevices(devices []device.Device) string {
+	ids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		if d.PCIAddress != "" {
+			ids = append(ids, d.PCIAddress)
+		} else {
+			ids = append(ids, d.DevPath)
+		}
+	}
+	return strings.Join(ids, ",")
+}
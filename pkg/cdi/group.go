@@ -0,0 +1,143 @@
+package cdi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+const (
+	// AllDevice is the composite device holding every device of the spec
+	AllDevice = "all"
+
+	// MembersAnnotation lists the devices of a composite device. Composite
+	// devices carry it so they are never advertised to kubelet.
+	MembersAnnotation = "device.members"
+	// switchGroupPrefix names the groups of devices behind one PCIe switch
+	switchGroupPrefix = "pcie-switch-"
+)
+
+// DeviceGroup is a named composite device made of several devices
+type DeviceGroup struct {
+	Name    string
+	Devices []string
+}
+
+// ParseGroups parses comma-separated groups of the form name=hailo0+hailo1
+func ParseGroups(value string) ([]DeviceGroup, error) {
+	var groups []DeviceGroup
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, members, ok := strings.Cut(entry, "=")
+		if !ok || members == "" {
+			return nil, fmt.Errorf("invalid device group %q, expected name=device+device", entry)
+		}
+		if !deviceNamePattern.MatchString(name) || name == AllDevice {
+			return nil, fmt.Errorf("invalid device group name %q", name)
+		}
+		groups = append(groups, DeviceGroup{Name: name, Devices: strings.Split(members, "+")})
+	}
+	return groups, nil
+}
+
+// switchGroups groups devices that sit behind the same PCIe switch, i.e.
+// share every upstream bridge except their own downstream port
+func switchGroups(devices []device.Device) []DeviceGroup {
+	members := make(map[string][]string)
+	for _, d := range devices {
+		if len(d.PCIPath) < 2 {
+			continue
+		}
+		upstream := d.PCIPath[len(d.PCIPath)-2]
+		members[upstream] = append(members[upstream], d.Name)
+	}
+
+	var groups []DeviceGroup
+	for upstream, names := range members {
+		if len(names) > 1 {
+			groups = append(groups, DeviceGroup{Name: switchGroupPrefix + upstream, Devices: names})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// compositeDevice merges the edits of its members into one device. Their
+// per-device env would clash, so it only sets the combined device list.
+func compositeDevice(name string, members []*DeviceSpec, devices []device.Device) *DeviceSpec {
+	names := make([]string, 0, len(members))
+	composite := &DeviceSpec{Name: name}
+	for _, m := range members {
+		names = append(names, m.Name)
+		composite.ContainerEdits.DeviceNodes = append(composite.ContainerEdits.DeviceNodes, m.ContainerEdits.DeviceNodes...)
+		composite.ContainerEdits.Mounts = append(composite.ContainerEdits.Mounts, m.ContainerEdits.Mounts...)
+	}
+	composite.Annotations = map[string]string{
+		"device.type":     "group",
+		MembersAnnotation: strings.Join(names, ","),
+	}
+	composite.ContainerEdits.Env = []string{"HAILO_VISIBLE_DEVICES=" + VisibleDevices(devices)}
+	return composite
+}
+
+// addGroups appends the all device and the configured and PCIe switch groups.
+// Members missing from the spec are skipped, as are groups left empty and
+// groups whose name is taken by a device.
+func (g *Generator) addGroups(spec *CDISpec, devices []device.Device) {
+	if len(spec.Devices) == 0 {
+		return
+	}
+
+	specs := make(map[string]*DeviceSpec, len(spec.Devices))
+	for _, d := range spec.Devices {
+		specs[d.Name] = d
+	}
+	records := make(map[string]device.Device, len(devices))
+	for _, d := range devices {
+		records[d.Name] = d
+	}
+
+	all := DeviceGroup{Name: AllDevice}
+	for _, d := range spec.Devices {
+		all.Devices = append(all.Devices, d.Name)
+	}
+	groups := append([]DeviceGroup{all}, g.Groups...)
+	if g.SwitchGroups {
+		groups = append(groups, switchGroups(devices)...)
+	}
+
+	for _, group := range groups {
+		if _, taken := specs[group.Name]; taken {
+			fmt.Fprintf(os.Stderr, "Warning: device group %s clashes with a device or group of the same name\n", group.Name)
+			continue
+		}
+
+		var members []*DeviceSpec
+		var memberDevices []device.Device
+		for _, name := range group.Devices {
+			if s, ok := specs[name]; ok && !IsComposite(s) {
+				members = append(members, s)
+				memberDevices = append(memberDevices, records[name])
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		composite := compositeDevice(group.Name, members, memberDevices)
+		specs[group.Name] = composite
+		spec.Devices = append(spec.Devices, composite)
+	}
+}
+
+// IsComposite reports whether a spec device is a group of other devices
+func IsComposite(d *DeviceSpec) bool {
+	_, ok := d.Annotations[MembersAnnotation]
+	return ok
+}
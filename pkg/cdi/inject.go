@@ -0,0 +1,145 @@
+package cdi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"hailo-device-plugin/pkg/hook"
+)
+
+// Injection lists host HailoRT files bind-mounted into every container, so
+// images do not have to bundle a libhailort matching the host driver. Entries
+// are host paths or globs, mounted at the same path in the container. It is
+// the cdi.injection section of the plugin config.
+type Injection struct {
+	// Libraries are shared libraries such as /usr/lib/libhailort.so*
+	Libraries []string `yaml:"libraries,omitempty"`
+	// Config are HailoRT config files or directories
+	Config []string `yaml:"config,omitempty"`
+	// Sockets are hailort_service sockets, mounted read-write
+	Sockets []string `yaml:"sockets,omitempty"`
+	// Firmware are firmware files or directories such as /lib/firmware/hailo
+	Firmware []string `yaml:"firmware,omitempty"`
+	// UpdateLdcache adds a hook refreshing the container's linker cache
+	// for the directories of the injected libraries
+	UpdateLdcache bool `yaml:"updateLdcache,omitempty"`
+	// Ldconfig is the host ldconfig binary, defaults to /sbin/ldconfig
+	Ldconfig string `yaml:"ldconfig,omitempty"`
+}
+
+// Validate requires every path to be absolute
+func (i *Injection) Validate() error {
+	for _, p := range i.paths() {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("injection path %q is not absolute", p)
+		}
+	}
+	if i.Ldconfig != "" && !filepath.IsAbs(i.Ldconfig) {
+		return fmt.Errorf("ldconfig path %q is not absolute", i.Ldconfig)
+	}
+	return nil
+}
+
+// IsEmpty reports whether the injection mounts nothing
+func (i *Injection) IsEmpty() bool {
+	return len(i.paths()) == 0
+}
+
+func (i *Injection) paths() []string {
+	var paths []string
+	for _, list := range [][]string{i.Libraries, i.Config, i.Sockets, i.Firmware} {
+		paths = append(paths, list...)
+	}
+	return paths
+}
+
+// injectionEdits renders the mounts and ldcache hook of the injection config.
+// Paths are resolved below the generator's HostRoot; entries matching nothing
+// are skipped, since the runtime refuses to start containers with a missing
+// mount source.
+func (g *Generator) injectionEdits() ([]*Mount, []*Hook) {
+	if g.Injection == nil {
+		return nil, nil
+	}
+
+	var mounts []*Mount
+	var libraryDirs []string
+	add := func(patterns []string, options []string, isLibrary bool) {
+		for _, pattern := range patterns {
+			paths := g.resolveHostPaths(pattern)
+			if len(paths) == 0 {
+				fmt.Fprintf(os.Stderr, "Warning: injection path %s not found on the host\n", pattern)
+			}
+			for _, p := range paths {
+				mounts = append(mounts, &Mount{
+					HostPath:      p,
+					ContainerPath: p,
+					Options:       options,
+				})
+				if isLibrary {
+					libraryDirs = append(libraryDirs, filepath.Dir(p))
+				}
+			}
+		}
+	}
+	readOnly := []string{"ro", "nosuid", "nodev", "bind"}
+	add(g.Injection.Libraries, readOnly, true)
+	add(g.Injection.Config, readOnly, false)
+	add(g.Injection.Firmware, readOnly, false)
+	add(g.Injection.Sockets, []string{"rw", "nosuid", "nodev", "bind"}, false)
+
+	if !g.Injection.UpdateLdcache || len(libraryDirs) == 0 {
+		return mounts, nil
+	}
+	ldconfig := g.Injection.Ldconfig
+	if ldconfig == "" {
+		ldconfig = hook.DefaultLdconfig
+	}
+	timeout := hookTimeout
+	hooks := []*Hook{{
+		HookName: hook.StageCreateContainer,
+		Path:     g.HookPath,
+		Args:     hook.LdcacheArgs(ldconfig, uniqueSorted(libraryDirs)),
+		Timeout:  &timeout,
+	}}
+	return mounts, hooks
+}
+
+// resolveHostPaths expands pattern below HostRoot and returns host paths
+func (g *Generator) resolveHostPaths(pattern string) []string {
+	root := g.HostRoot
+	if root == "" {
+		root = "/"
+	}
+	matches, err := filepath.Glob(filepath.Join(root, pattern))
+	if err != nil {
+		return nil
+	}
+
+	paths := make([]string, 0, len(matches))
+	for _, m := range matches {
+		rel, err := filepath.Rel(root, m)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		paths = append(paths, "/"+filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,85 @@
+package cdi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/hook"
+)
+
+func TestGenerator_Injection(t *testing.T) {
+	hostRoot := t.TempDir()
+	for _, file := range []string{
+		"usr/lib/libhailort.so.4.23.0",
+		"usr/lib/libhailort.so",
+		"usr/local/lib/libhailo_extra.so",
+		"etc/hailort/hailort.conf",
+		"tmp/hailort_uds.sock",
+		"lib/firmware/hailo/hailo8_fw.bin",
+	} {
+		path := filepath.Join(hostRoot, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	injection := &Injection{
+		Libraries:     []string{"/usr/lib/libhailort.so*", "/usr/local/lib/libhailo_extra.so"},
+		Config:        []string{"/etc/hailort"},
+		Sockets:       []string{"/tmp/hailort_uds.sock"},
+		Firmware:      []string{"/lib/firmware/hailo", "/lib/firmware/missing"},
+		UpdateLdcache: true,
+	}
+	if err := injection.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	generator := NewGenerator(t.TempDir(), t.TempDir())
+	generator.HostRoot = hostRoot
+	generator.Injection = injection
+	spec := generator.BuildSpec([]device.Device{device.New("hailo0")})
+	if err := Validate(spec); err != nil {
+		t.Fatalf("Spec with injection does not validate: %v", err)
+	}
+
+	mounts := make(map[string][]string)
+	for _, m := range spec.ContainerEdits.Mounts {
+		mounts[m.HostPath] = m.Options
+	}
+	readOnly := []string{"ro", "nosuid", "nodev", "bind"}
+	expected := map[string][]string{
+		"tmpfs":                            spec.ContainerEdits.Mounts[0].Options,
+		"/usr/lib/libhailort.so":           readOnly,
+		"/usr/lib/libhailort.so.4.23.0":    readOnly,
+		"/usr/local/lib/libhailo_extra.so": readOnly,
+		"/etc/hailort":                     readOnly,
+		"/lib/firmware/hailo":              readOnly,
+		"/tmp/hailort_uds.sock":            {"rw", "nosuid", "nodev", "bind"},
+	}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("Unexpected global mounts:\nwant %v\ngot  %v", expected, mounts)
+	}
+
+	last := spec.ContainerEdits.Hooks[len(spec.ContainerEdits.Hooks)-1]
+	wantArgs := hook.LdcacheArgs(hook.DefaultLdconfig, []string{"/usr/lib", "/usr/local/lib"})
+	if last.HookName != hook.StageCreateContainer || !reflect.DeepEqual(last.Args, wantArgs) {
+		t.Errorf("Expected ldcache hook %v, got %s %v", wantArgs, last.HookName, last.Args)
+	}
+}
+
+func TestInjection_RelativePath(t *testing.T) {
+	for _, injection := range []Injection{
+		{Libraries: []string{"usr/lib/libhailort.so"}},
+		{Ldconfig: "sbin/ldconfig"},
+	} {
+		if err := injection.Validate(); err == nil {
+			t.Errorf("Expected error for a relative path in %+v", injection)
+		}
+	}
+}
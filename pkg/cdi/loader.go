@@ -0,0 +1,232 @@
+package cdi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSpecDirs are the CDI spec directories in increasing priority: specs
+// in /var/run/cdi, usually generated at runtime, override static ones in /etc/cdi
+var DefaultSpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// LoadedSpec is a spec file read by LoadSpecs
+type LoadedSpec struct {
+	*CDISpec
+	Path string
+	// Priority is the index of the spec directory, higher wins
+	Priority int
+}
+
+// Conflict reports a device name defined by more than one spec file. Files
+// in one directory cannot be ordered, so the device is dropped; otherwise
+// the spec of the later directory wins.
+type Conflict struct {
+	Name  string
+	Paths []string
+	// Winner is the path whose device is used, empty if it was dropped
+	Winner string
+}
+
+func (c Conflict) String() string {
+	if c.Winner == "" {
+		return fmt.Sprintf("device %s is defined by %s, dropped", c.Name, strings.Join(c.Paths, " and "))
+	}
+	return fmt.Sprintf("device %s is defined by %s, using %s", c.Name, strings.Join(c.Paths, " and "), c.Winner)
+}
+
+// SpecSet is the merged view of the Hailo specs found in the spec directories
+type SpecSet struct {
+	Specs []*LoadedSpec
+	// Devices maps each resolved device name to the spec defining it
+	Devices   map[string]*LoadedSpec
+	Conflicts []Conflict
+	// Errors holds the spec files that could not be read, parsed or validated
+	Errors map[string]error
+}
+
+// DeviceNames returns the resolved devices sorted by index, leaving out the
+// all device and device groups
+func (s *SpecSet) DeviceNames() []string {
+	var names []string
+	for name, spec := range s.Devices {
+		if d := spec.device(name); d != nil && !IsComposite(d) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := device.IndexFromName(names[i]), device.IndexFromName(names[j])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// device returns the named device of the spec
+func (s *LoadedSpec) device(name string) *DeviceSpec {
+	for _, d := range s.Devices {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// LoadSpecs reads every .json, .yaml and .yml spec of kind hailo.ai/npu in
+// dirs, given in increasing priority, and merges their devices. Missing
+// directories are skipped and broken files are reported in Errors.
+func LoadSpecs(dirs []string) (*SpecSet, error) {
+	set := &SpecSet{
+		Devices: make(map[string]*LoadedSpec),
+		Errors:  make(map[string]error),
+	}
+	// Every definition of a device, in load order
+	definitions := make(map[string][]*LoadedSpec)
+
+	for priority, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spec dir %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !isSpecFile(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := readSpecJSON(path)
+			if err != nil {
+				set.Errors[path] = err
+				continue
+			}
+			// Specs of other vendors may use newer versions and fields, they are skipped before the strict decode
+			var header struct {
+				Kind string `json:"kind"`
+			}
+			if err := json.Unmarshal(data, &header); err != nil {
+				set.Errors[path] = fmt.Errorf("failed to parse spec: %w", err)
+				continue
+			}
+			if header.Kind != Kind {
+				continue
+			}
+			spec, err := decodeSpec(data)
+			if err != nil {
+				set.Errors[path] = err
+				continue
+			}
+
+			loaded := &LoadedSpec{CDISpec: spec, Path: path, Priority: priority}
+			set.Specs = append(set.Specs, loaded)
+			for _, d := range spec.Devices {
+				definitions[d.Name] = append(definitions[d.Name], loaded)
+			}
+		}
+	}
+
+	for name, specs := range definitions {
+		winner := resolve(specs)
+		if winner != nil {
+			set.Devices[name] = winner
+		}
+		if len(specs) > 1 {
+			conflict := Conflict{Name: name}
+			for _, s := range specs {
+				conflict.Paths = append(conflict.Paths, s.Path)
+			}
+			if winner != nil {
+				conflict.Winner = winner.Path
+			}
+			set.Conflicts = append(set.Conflicts, conflict)
+		}
+	}
+	sort.Slice(set.Conflicts, func(i, j int) bool { return set.Conflicts[i].Name < set.Conflicts[j].Name })
+	return set, nil
+}
+
+// resolve picks the definition from the highest priority directory, or nil
+// if that directory defines the device more than once
+func resolve(specs []*LoadedSpec) *LoadedSpec {
+	var winner *LoadedSpec
+	tie := false
+	for _, s := range specs {
+		switch {
+		case winner == nil || s.Priority > winner.Priority:
+			winner, tie = s, false
+		case s.Priority == winner.Priority:
+			tie = true
+		}
+	}
+	if tie {
+		return nil
+	}
+	return winner
+}
+
+func isSpecFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// ReadSpec reads and validates a JSON or YAML spec file
+func ReadSpec(path string) (*CDISpec, error) {
+	data, err := readSpecJSON(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSpec(data)
+}
+
+// readSpecJSON reads a spec file, converting YAML to JSON
+func readSpecJSON(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// decodeSpec strictly decodes and validates a JSON spec
+func decodeSpec(data []byte) (*CDISpec, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var spec CDISpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+	if err := Validate(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// yamlToJSON converts YAML to JSON, so specs of both formats share the json tags
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,111 @@
+package cdi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const jsonSpec = `{
+  "cdiVersion": "0.5.0",
+  "kind": "hailo.ai/npu",
+  "devices": [
+    {"name": "hailo0", "containerEdits": {"deviceNodes": [{"path": "/dev/hailo0", "hostPath": "/dev/hailo0"}]}},
+    {"name": "hailo1", "containerEdits": {"deviceNodes": [{"path": "/dev/hailo1", "hostPath": "/dev/hailo1"}]}}
+  ]
+}`
+
+const yamlSpec = `cdiVersion: 0.6.0
+kind: hailo.ai/npu
+devices:
+  - name: hailo1
+    annotations:
+      origin: runtime
+    containerEdits:
+      deviceNodes:
+        - path: /dev/hailo1
+          hostPath: /dev/hailo1
+          major: 507
+          minor: 1
+  - name: hailo2
+    containerEdits:
+      deviceNodes:
+        - path: /dev/hailo2
+`
+
+func writeSpec(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestLoadSpecs_PrecedenceAndYAML(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc/cdi")
+	run := filepath.Join(root, "var/run/cdi")
+
+	static := writeSpec(t, etc, "hailo.json", jsonSpec)
+	dynamic := writeSpec(t, run, "hailo.yaml", yamlSpec)
+	writeSpec(t, etc, "other.json", `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "hailo0", "containerEdits": {"env": ["A=1"]}}]}`)
+	// Other vendors' specs may use versions and fields this plugin does not know
+	writeSpec(t, run, "future.yaml", "cdiVersion: 9.0.0\nkind: vendor.com/fpga\nfutureEdits: {}\ndevices: []\n")
+	broken := writeSpec(t, run, "broken.yml", "cdiVersion: [")
+	writeSpec(t, run, "notes.txt", "ignored")
+
+	set, err := LoadSpecs([]string{etc, run, filepath.Join(root, "missing")})
+	if err != nil {
+		t.Fatalf("LoadSpecs failed: %v", err)
+	}
+
+	if names := set.DeviceNames(); !reflect.DeepEqual(names, []string{"hailo0", "hailo1", "hailo2"}) {
+		t.Errorf("Unexpected devices %v", names)
+	}
+	if set.Devices["hailo0"].Path != static || set.Devices["hailo1"].Path != dynamic {
+		t.Error("Expected /var/run/cdi to override /etc/cdi and keep hailo0 from /etc/cdi")
+	}
+
+	node := set.Devices["hailo1"].device("hailo1").ContainerEdits.DeviceNodes[0]
+	if node.Major == nil || *node.Major != 507 || *node.Minor != 1 {
+		t.Errorf("Expected YAML device numbers to be parsed, got %+v", node)
+	}
+
+	expected := []Conflict{{Name: "hailo1", Paths: []string{static, dynamic}, Winner: dynamic}}
+	if !reflect.DeepEqual(set.Conflicts, expected) {
+		t.Errorf("Expected conflicts %v, got %v", expected, set.Conflicts)
+	}
+	if _, ok := set.Errors[broken]; !ok || len(set.Errors) != 1 {
+		t.Errorf("Expected only the broken YAML spec to be reported, got %v", set.Errors)
+	}
+}
+
+func TestLoadSpecs_SameDirConflictDropsDevice(t *testing.T) {
+	dir := t.TempDir()
+	first := writeSpec(t, dir, "a.json", jsonSpec)
+	second := writeSpec(t, dir, "b.yaml", yamlSpec)
+
+	set, err := LoadSpecs([]string{dir})
+	if err != nil {
+		t.Fatalf("LoadSpecs failed: %v", err)
+	}
+
+	if names := set.DeviceNames(); !reflect.DeepEqual(names, []string{"hailo0", "hailo2"}) {
+		t.Errorf("Expected hailo1 to be dropped, got %v", names)
+	}
+	expected := []Conflict{{Name: "hailo1", Paths: []string{first, second}}}
+	if !reflect.DeepEqual(set.Conflicts, expected) {
+		t.Errorf("Expected conflicts %v, got %v", expected, set.Conflicts)
+	}
+}
+
+func TestReadDevices_NoSpec(t *testing.T) {
+	if _, err := ReadDevices(t.TempDir()); err == nil {
+		t.Error("Expected an error without any Hailo spec")
+	}
+}
@@ -0,0 +1,114 @@
+package cdi
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// decodeStrict decodes a spec, failing on any field the model does not know
+func decodeStrict(t *testing.T, data []byte) *CDISpec {
+	t.Helper()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var spec CDISpec
+	if err := decoder.Decode(&spec); err != nil {
+		t.Fatalf("Failed to decode spec: %v", err)
+	}
+	return &spec
+}
+
+func TestSpec_RoundTripFixtures(t *testing.T) {
+	for _, path := range []string{"../../cdi.json", "../../tests/hailo.json", "testdata/full.json"} {
+		t.Run(path, func(t *testing.T) {
+			original, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+
+			spec := decodeStrict(t, original)
+			if err := Validate(spec); err != nil {
+				t.Errorf("Fixture does not validate: %v", err)
+			}
+
+			encoded, err := json.Marshal(spec)
+			if err != nil {
+				t.Fatalf("Failed to encode spec: %v", err)
+			}
+
+			var want, got interface{}
+			json.Unmarshal(original, &want)
+			json.Unmarshal(encoded, &got)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Round-trip lost data:\nwant: %v\ngot:  %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	base := func() *CDISpec {
+		return &CDISpec{
+			Kind: "hailo.ai/npu",
+			Devices: []*DeviceSpec{{
+				Name: "hailo0",
+				ContainerEdits: ContainerEdits{
+					DeviceNodes: []*DeviceNode{{Path: "/dev/hailo0"}},
+				},
+			}},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		modify   func(*CDISpec)
+		expected string
+	}{
+		{"plain", func(*CDISpec) {}, "0.3.0"},
+		{"mount type", func(s *CDISpec) {
+			s.ContainerEdits = &ContainerEdits{Mounts: []*Mount{{HostPath: "/a", ContainerPath: "/a", Type: "bind"}}}
+		}, "0.4.0"},
+		{"host path", func(s *CDISpec) { s.Devices[0].ContainerEdits.DeviceNodes[0].HostPath = "/dev/hailo0" }, "0.5.0"},
+		{"digit name", func(s *CDISpec) { s.Devices[0].Name = "0" }, "0.5.0"},
+		{"device annotations", func(s *CDISpec) { s.Devices[0].Annotations = map[string]string{"a": "b"} }, "0.6.0"},
+		{"dotted class", func(s *CDISpec) { s.Kind = "hailo.ai/npu.v2" }, "0.6.0"},
+		{"intelRdt", func(s *CDISpec) { s.Devices[0].ContainerEdits.IntelRdt = &IntelRdt{ClosID: "npu"} }, "0.7.0"},
+		{"additional gids", func(s *CDISpec) { s.ContainerEdits = &ContainerEdits{AdditionalGIDs: []uint32{44}} }, "0.7.0"},
+	}
+
+	for _, tc := range testCases {
+		spec := base()
+		tc.modify(spec)
+		if got := MinimumVersion(spec); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec CDISpec
+	}{
+		{"version too old", CDISpec{Version: "0.5.0", Kind: "hailo.ai/npu", Annotations: map[string]string{"a": "b"}}},
+		{"unknown version", CDISpec{Version: "9.0.0", Kind: "hailo.ai/npu"}},
+		{"bad kind", CDISpec{Version: "0.7.0", Kind: "npu"}},
+		{"duplicate device", CDISpec{Version: "0.7.0", Kind: "hailo.ai/npu", Devices: []*DeviceSpec{{Name: "hailo0"}, {Name: "hailo0"}}}},
+		{"relative node", CDISpec{Version: "0.7.0", Kind: "hailo.ai/npu", Devices: []*DeviceSpec{{
+			Name:           "hailo0",
+			ContainerEdits: ContainerEdits{DeviceNodes: []*DeviceNode{{Path: "dev/hailo0"}}},
+		}}}},
+		{"bad hook", CDISpec{Version: "0.7.0", Kind: "hailo.ai/npu", ContainerEdits: &ContainerEdits{
+			Hooks: []*Hook{{HookName: "poststart-ish", Path: "/bin/true"}},
+		}}},
+	}
+
+	for _, tc := range testCases {
+		if err := Validate(&tc.spec); err == nil {
+			t.Errorf("%s: expected validation error", tc.name)
+		}
+	}
+}
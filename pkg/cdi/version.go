@@ -0,0 +1,227 @@
+package cdi
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Spec versions this package can read and write, oldest first
+var specVersions = []string{"0.3.0", "0.4.0", "0.5.0", "0.6.0", "0.7.0"}
+
+// LatestVersion is the newest cdiVersion understood by this package
+var LatestVersion = specVersions[len(specVersions)-1]
+
+var (
+	vendorPattern     = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	classPattern      = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+	deviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.:-]*[A-Za-z0-9])?$`)
+)
+
+// validHooks are the OCI hook names a CDI spec may use
+var validHooks = map[string]bool{
+	"prestart":        true,
+	"createRuntime":   true,
+	"createContainer": true,
+	"startContainer":  true,
+	"poststart":       true,
+	"poststop":        true,
+}
+
+// MinimumVersion returns the oldest cdiVersion able to express spec, following
+// the feature rules of the upstream specification:
+//
+//	0.4.0 mount type
+//	0.5.0 device node hostPath, device names starting with a digit
+//	0.6.0 annotations, dots in the kind's class
+//	0.7.0 intelRdt, additionalGids
+func MinimumVersion(spec *CDISpec) string {
+	switch {
+	case requiresV070(spec):
+		return "0.7.0"
+	case requiresV060(spec):
+		return "0.6.0"
+	case requiresV050(spec):
+		return "0.5.0"
+	case requiresV040(spec):
+		return "0.4.0"
+	}
+	return "0.3.0"
+}
+
+func requiresV070(spec *CDISpec) bool {
+	return anyEdits(spec, func(e *ContainerEdits) bool {
+		return e.IntelRdt != nil || len(e.AdditionalGIDs) > 0
+	})
+}
+
+func requiresV060(spec *CDISpec) bool {
+	if len(spec.Annotations) > 0 {
+		return true
+	}
+	for _, d := range spec.Devices {
+		if len(d.Annotations) > 0 {
+			return true
+		}
+	}
+	_, class, _ := strings.Cut(spec.Kind, "/")
+	return strings.Contains(class, ".")
+}
+
+func requiresV050(spec *CDISpec) bool {
+	for _, d := range spec.Devices {
+		if d.Name != "" && d.Name[0] >= '0' && d.Name[0] <= '9' {
+			return true
+		}
+	}
+	return anyEdits(spec, func(e *ContainerEdits) bool {
+		for _, n := range e.DeviceNodes {
+			if n.HostPath != "" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func requiresV040(spec *CDISpec) bool {
+	return anyEdits(spec, func(e *ContainerEdits) bool {
+		for _, m := range e.Mounts {
+			if m.Type != "" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// anyEdits reports whether fn holds for the global or any device's edits
+func anyEdits(spec *CDISpec, fn func(*ContainerEdits) bool) bool {
+	if spec.ContainerEdits != nil && fn(spec.ContainerEdits) {
+		return true
+	}
+	for _, d := range spec.Devices {
+		if fn(&d.ContainerEdits) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares two x.y.z versions, an optional v prefix is ignored
+func compareVersions(a, b string) (int, error) {
+	pa, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([3]int, error) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return parsed, fmt.Errorf("invalid cdiVersion %q", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("invalid cdiVersion %q", version)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// Validate checks spec against the CDI schema and verifies that its cdiVersion
+// is known and new enough for the features it uses
+func Validate(spec *CDISpec) error {
+	known := false
+	for _, v := range specVersions {
+		if v == strings.TrimPrefix(spec.Version, "v") {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unsupported cdiVersion %q", spec.Version)
+	}
+	required := MinimumVersion(spec)
+	if cmp, _ := compareVersions(spec.Version, required); cmp < 0 {
+		return fmt.Errorf("cdiVersion %s is too old, the spec requires at least %s", spec.Version, required)
+	}
+
+	vendor, class, ok := strings.Cut(spec.Kind, "/")
+	if !ok || !vendorPattern.MatchString(vendor) || !classPattern.MatchString(class) {
+		return fmt.Errorf("invalid kind %q, expected <vendor>/<class>", spec.Kind)
+	}
+
+	if spec.ContainerEdits != nil {
+		if err := validateEdits(spec.ContainerEdits); err != nil {
+			return fmt.Errorf("global containerEdits: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool, len(spec.Devices))
+	for _, d := range spec.Devices {
+		if !deviceNamePattern.MatchString(d.Name) {
+			return fmt.Errorf("invalid device name %q", d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate device name %q", d.Name)
+		}
+		seen[d.Name] = true
+		if err := validateEdits(&d.ContainerEdits); err != nil {
+			return fmt.Errorf("device %s: %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateEdits(e *ContainerEdits) error {
+	for _, env := range e.Env {
+		if key, _, ok := strings.Cut(env, "="); !ok || key == "" {
+			return fmt.Errorf("invalid env %q, expected KEY=VALUE", env)
+		}
+	}
+	for _, n := range e.DeviceNodes {
+		if !filepath.IsAbs(n.Path) {
+			return fmt.Errorf("device node path %q is not absolute", n.Path)
+		}
+		switch n.Type {
+		case "", "b", "c", "u", "p":
+		default:
+			return fmt.Errorf("device node %s has invalid type %q", n.Path, n.Type)
+		}
+		if strings.Trim(n.Permissions, "rwm") != "" {
+			return fmt.Errorf("device node %s has invalid permissions %q", n.Path, n.Permissions)
+		}
+	}
+	for _, h := range e.Hooks {
+		if !validHooks[h.HookName] {
+			return fmt.Errorf("invalid hook name %q", h.HookName)
+		}
+		if h.Path == "" {
+			return fmt.Errorf("%s hook has no path", h.HookName)
+		}
+	}
+	for _, m := range e.Mounts {
+		if m.HostPath == "" || m.ContainerPath == "" {
+			return fmt.Errorf("mount %q -> %q is missing a path", m.HostPath, m.ContainerPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cdi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SpecHashAnnotation records the hash of the rendered spec for traceability
+const SpecHashAnnotation = "spec-hash"
+
+// MarshalSpec renders spec as indented JSON with its content hash stored in the
+// SpecHashAnnotation. The hash covers the spec without the annotation itself.
+func MarshalSpec(spec *CDISpec) ([]byte, error) {
+	annotations := make(map[string]string, len(spec.Annotations)+1)
+	for k, v := range spec.Annotations {
+		if k != SpecHashAnnotation {
+			annotations[k] = v
+		}
+	}
+
+	unhashed := *spec
+	unhashed.Annotations = annotations
+	data, err := json.MarshalIndent(&unhashed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	hashed := unhashed
+	hashed.Annotations = make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		hashed.Annotations[k] = v
+	}
+	hashed.Annotations[SpecHashAnnotation] = "sha256:" + hex.EncodeToString(sum[:])
+	return json.MarshalIndent(&hashed, "", "  ")
+}
+
+// WriteFileIfChanged atomically replaces path with data unless the file already
+// holds exactly these bytes. It reports whether the file was written.
+func WriteFileIfChanged(path string, data []byte, perm os.FileMode) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	if err := writeFileAtomic(path, data, perm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFileAtomic writes data to a temp file in the same directory, syncs it
+// and renames it over path, so readers never see a partial file. The temp name
+// does not end in .json, which keeps CDI directory watchers from loading it.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to chmod %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", tmpPath, path, err)
+	}
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,569 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+	"hailo-device-plugin/pkg/plugin"
+	"hailo-device-plugin/pkg/statemachine"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix starts the env var of every flag, e.g. HAILO_DEVICE_PLUGIN_CDI_DIR
+	EnvPrefix = "HAILO_DEVICE_PLUGIN_"
+
+	configFlag      = "config"
+	printConfigFlag = "print-config"
+)
+
+// envAliases are env vars honoured for compatibility, below the prefixed name
+var envAliases = map[string]string{
+	"kubelet-version": "KUBELET_VERSION",
+	"node-name":       "NODE_NAME",
+}
+
+// Config is the complete plugin configuration
+type Config struct {
+	Kubelet   Kubelet   `yaml:"kubelet"`
+	Plugin    Plugin    `yaml:"plugin"`
+	Discovery Discovery `yaml:"discovery"`
+	Health    Health    `yaml:"health"`
+	CDI       CDI       `yaml:"cdi"`
+	Sharing   Sharing   `yaml:"sharing"`
+}
+
+// Kubelet describes the kubelet the plugin registers with
+type Kubelet struct {
+	Socket string `yaml:"socket"`
+	// Version picks the allocation mode for auto, empty reads it from the node
+	Version string `yaml:"version"`
+	// NodeName is the node whose kubelet version is read when Version is empty
+	NodeName string `yaml:"nodeName"`
+}
+
+// Plugin configures the device plugin servers and their registration
+type Plugin struct {
+	Socket       string `yaml:"socket"`
+	ResourceName string `yaml:"resourceName"`
+	// ModelResources are advertised as <domain>/<model> next to ResourceName
+	ModelResources   []string      `yaml:"modelResources"`
+	AllocationMode   string        `yaml:"allocationMode"`
+	RegisterRetries  int           `yaml:"registerRetries"`
+	RegisterTimeout  time.Duration `yaml:"registerTimeout"`
+	RegisterBackoff  time.Duration `yaml:"registerBackoff"`
+	ServerStartDelay time.Duration `yaml:"serverStartDelay"`
+	RestartInterval  time.Duration `yaml:"restartInterval"`
+}
+
+// Discovery configures how devices are found
+type Discovery struct {
+	Backends       []string      `yaml:"backends"`
+	StaticDevices  string        `yaml:"staticDevices"`
+	Hailortcli     string        `yaml:"hailortcli"`
+	ResyncInterval time.Duration `yaml:"resyncInterval"`
+	HotplugSettle  time.Duration `yaml:"hotplugSettle"`
+}
+
+// Health configures device health checks and damping
+type Health struct {
+	Interval time.Duration `yaml:"interval"`
+	// Probe is a command and its arguments with {name}, {dev} and {pci} placeholders
+	Probe            []string      `yaml:"probe"`
+	ProbeTimeout     time.Duration `yaml:"probeTimeout"`
+	FailureThreshold int           `yaml:"failureThreshold"`
+	SuccessThreshold int           `yaml:"successThreshold"`
+	StatusFile       string        `yaml:"statusFile"`
+}
+
+// CDI configures the generated spec
+type CDI struct {
+	Dir string `yaml:"dir"`
+	// SpecDirs are checked for conflicts with the generated spec, in increasing priority
+	SpecDirs     []string `yaml:"specDirs"`
+	GlobalEnv    []string `yaml:"globalEnv"`
+	DeviceEnv    []string `yaml:"deviceEnv"`
+	Groups       []string `yaml:"groups"`
+	SwitchGroups bool     `yaml:"switchGroups"`
+	// Injection lists host HailoRT files mounted into every container
+	Injection cdi.Injection `yaml:"injection"`
+	HostRoot  string        `yaml:"hostRoot"`
+}
+
+// Sharing configures time-slicing and hailort_service slots
+type Sharing struct {
+	Replicas             Replicas      `yaml:"replicas"`
+	HailortService       bool          `yaml:"hailortService"`
+	ServiceSocket        string        `yaml:"serviceSocket"`
+	ServiceProbeInterval time.Duration `yaml:"serviceProbeInterval"`
+}
+
+// Replicas is the number of virtual devices per device, see plugin.Replicas
+type Replicas struct {
+	Default int            `yaml:"default,omitempty"`
+	Models  map[string]int `yaml:"models,omitempty"`
+}
+
+// Options are command line settings that are not part of the configuration
+type Options struct {
+	// Path is the YAML file that was read, empty if none
+	Path string
+	// Print asks for the effective configuration to be printed
+	Print bool
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Kubelet: Kubelet{
+			Socket: plugin.DefaultKubeletSocket,
+		},
+		Plugin: Plugin{
+			Socket:           "/var/lib/kubelet/device-plugins/hailo.sock",
+			ResourceName:     cdi.Kind,
+			AllocationMode:   string(plugin.AllocationModeAuto),
+			RegisterRetries:  statemachine.DefaultRegisterRetries,
+			RegisterTimeout:  plugin.DefaultRegisterTimeout,
+			RegisterBackoff:  plugin.DefaultRegisterBackoff,
+			ServerStartDelay: statemachine.DefaultServerStartDelay,
+			RestartInterval:  statemachine.DefaultRestartInterval,
+		},
+		Discovery: Discovery{
+			Backends:       []string{"sysfs"},
+			Hailortcli:     monitor.DefaultHailortcliPath,
+			ResyncInterval: monitor.DefaultResyncInterval,
+			HotplugSettle:  monitor.DefaultHotplugSettle,
+		},
+		Health: Health{
+			Interval:         monitor.DefaultHealthInterval,
+			ProbeTimeout:     monitor.DefaultProbeTimeout,
+			FailureThreshold: monitor.DefaultFailureThreshold,
+			SuccessThreshold: monitor.DefaultSuccessThreshold,
+			StatusFile:       "/var/lib/hailo-cdi/health.json",
+		},
+		CDI: CDI{
+			Dir:       "/etc/cdi",
+			SpecDirs:  append([]string(nil), cdi.DefaultSpecDirs...),
+			DeviceEnv: append([]string(nil), cdi.DefaultDeviceEnv...),
+			HostRoot:  "/",
+		},
+		Sharing: Sharing{
+			ServiceSocket:        plugin.DefaultServiceSocket,
+			ServiceProbeInterval: plugin.DefaultServiceProbeInterval,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file given with
+// --config or $HAILO_DEVICE_PLUGIN_CONFIG, HAILO_DEVICE_PLUGIN_* env vars and
+// the command line, each overriding the ones before. The result is not validated.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	// A first pass only looks for the config file, the file sets the flag defaults
+	var opts Options
+	probe := newFlagSet(Default(), &opts)
+	probe.SetOutput(io.Discard)
+	probe.Parse(args)
+	if opts.Path == "" {
+		opts.Path, _ = lookupEnv(EnvName(configFlag))
+	}
+
+	cfg := Default()
+	if opts.Path != "" {
+		if err := cfg.readFile(opts.Path); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	fs := newFlagSet(cfg, &opts)
+	var envErrs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+		key := EnvName(f.Name)
+		value, ok := lookupEnv(key)
+		if !ok {
+			if key, ok = envAliases[f.Name]; ok {
+				value, ok = lookupEnv(key)
+			}
+		}
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErrs = append(envErrs, fmt.Errorf("invalid %s: %w", key, err))
+		}
+	})
+	if err := errors.Join(envErrs...); err != nil {
+		return nil, opts, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+	if fs.NArg() > 0 {
+		return nil, opts, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	cfg.normalize()
+	return cfg, opts, nil
+}
+
+// EnvName returns the env var overriding a flag, e.g. cdi-dir -> HAILO_DEVICE_PLUGIN_CDI_DIR
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readFile decodes a YAML file over c, rejecting unknown keys
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// normalize brings model names into the form used in resource names and
+// treats empty lists like unset ones
+func (c *Config) normalize() {
+	for _, list := range []*[]string{
+		&c.Plugin.ModelResources, &c.Discovery.Backends, &c.Health.Probe, &c.CDI.SpecDirs,
+		&c.CDI.GlobalEnv, &c.CDI.DeviceEnv, &c.CDI.Groups,
+		&c.CDI.Injection.Libraries, &c.CDI.Injection.Config, &c.CDI.Injection.Sockets, &c.CDI.Injection.Firmware,
+	} {
+		if len(*list) == 0 {
+			*list = nil
+		}
+	}
+	for i, model := range c.Plugin.ModelResources {
+		c.Plugin.ModelResources[i] = device.NormalizeModel(model)
+	}
+	if len(c.Sharing.Replicas.Models) > 0 {
+		models := make(map[string]int, len(c.Sharing.Replicas.Models))
+		for model, n := range c.Sharing.Replicas.Models {
+			models[device.NormalizeModel(model)] = n
+		}
+		c.Sharing.Replicas.Models = models
+	}
+}
+
+// YAML renders the configuration in the format read by --config
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(filepath.IsAbs(c.Kubelet.Socket), "kubelet.socket must be an absolute path, got %q", c.Kubelet.Socket)
+
+	check(filepath.IsAbs(c.Plugin.Socket), "plugin.socket must be an absolute path, got %q", c.Plugin.Socket)
+	domain, name, ok := strings.Cut(c.Plugin.ResourceName, "/")
+	check(ok && domain != "" && name != "", "plugin.resourceName must look like <domain>/<name>, got %q", c.Plugin.ResourceName)
+	seen := make(map[string]bool)
+	firmwareAware := false
+	for _, backend := range c.Discovery.Backends {
+		firmwareAware = firmwareAware || backend == "hailortcli" || backend == "static"
+	}
+	for _, model := range c.Plugin.ModelResources {
+		check(model != "", "plugin.modelResources has an empty model")
+		check(!seen[model], "plugin.modelResources lists %s twice", model)
+		seen[model] = true
+		// sysfs only has the PCI ID, which Hailo-8 and Hailo-8L share
+		check(!device.RequiresFirmware(model) || firmwareAware,
+			"plugin.modelResources: %s can only be detected from firmware data, add the hailortcli or static backend to discovery.backends", model)
+	}
+	if _, err := plugin.ParseAllocationMode(c.Plugin.AllocationMode); err != nil {
+		errs = append(errs, fmt.Errorf("plugin.allocationMode: %w", err))
+	}
+	check(c.Plugin.RegisterRetries >= 1, "plugin.registerRetries must be at least 1")
+	checkDurations(check, map[string]time.Duration{
+		"plugin.registerTimeout":       c.Plugin.RegisterTimeout,
+		"plugin.registerBackoff":       c.Plugin.RegisterBackoff,
+		"plugin.serverStartDelay":      c.Plugin.ServerStartDelay,
+		"plugin.restartInterval":       c.Plugin.RestartInterval,
+		"discovery.resyncInterval":     c.Discovery.ResyncInterval,
+		"discovery.hotplugSettle":      c.Discovery.HotplugSettle,
+		"health.interval":              c.Health.Interval,
+		"health.probeTimeout":          c.Health.ProbeTimeout,
+		"sharing.serviceProbeInterval": c.Sharing.ServiceProbeInterval,
+	})
+
+	if _, err := monitor.NewDiscoverer(strings.Join(c.Discovery.Backends, ","), monitor.DiscovererOptions{
+		StaticPath: c.Discovery.StaticDevices,
+	}); err != nil {
+		errs = append(errs, fmt.Errorf("discovery.backends: %w", err))
+	}
+
+	check(c.Health.FailureThreshold >= 1, "health.failureThreshold must be at least 1")
+	check(c.Health.SuccessThreshold >= 1, "health.successThreshold must be at least 1")
+
+	check(c.CDI.Dir != "", "cdi.dir must be set")
+	check(len(c.CDI.SpecDirs) > 0, "cdi.specDirs must list at least one directory")
+	if _, err := cdi.ParseEnvTemplates(c.CDI.GlobalEnv, c.CDI.DeviceEnv); err != nil {
+		errs = append(errs, fmt.Errorf("cdi env: %w", err))
+	}
+	if _, err := cdi.ParseGroups(strings.Join(c.CDI.Groups, ",")); err != nil {
+		errs = append(errs, fmt.Errorf("cdi.groups: %w", err))
+	}
+	if err := c.CDI.Injection.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("cdi.injection: %w", err))
+	}
+	check(filepath.IsAbs(c.CDI.HostRoot), "cdi.hostRoot must be an absolute path, got %q", c.CDI.HostRoot)
+
+	check(c.Sharing.Replicas.Default >= 0, "sharing.replicas.default must not be negative")
+	for model, n := range c.Sharing.Replicas.Models {
+		check(model != "" && n >= 1, "sharing.replicas.models needs a model and a positive count, got %s=%d", model, n)
+	}
+	if c.Sharing.HailortService {
+		check(filepath.IsAbs(c.Sharing.ServiceSocket), "sharing.serviceSocket must be an absolute path, got %q", c.Sharing.ServiceSocket)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkDurations requires every named duration to be positive, in name order
+func checkDurations(check func(bool, string, ...interface{}), durations map[string]time.Duration) {
+	names := make([]string, 0, len(durations))
+	for name := range durations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check(durations[name] > 0, "%s must be positive, got %v", name, durations[name])
+	}
+}
+
+// newFlagSet binds a flag to every setting of c, with the current values as defaults
+func newFlagSet(c *Config, opts *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet("hailo-device-plugin", flag.ContinueOnError)
+
+	fs.StringVar(&opts.Path, configFlag, "", "YAML configuration file (env "+EnvName(configFlag)+")")
+	fs.BoolVar(&opts.Print, printConfigFlag, false, "Print the effective configuration as YAML and exit")
+
+	fs.StringVar(&c.Kubelet.Socket, "kubelet-socket", c.Kubelet.Socket, "Kubelet registration socket")
+	fs.StringVar(&c.Kubelet.Version, "kubelet-version", c.Kubelet.Version,
+		"Kubelet version used by --allocation-mode=auto (also read from $KUBELET_VERSION), empty reads it from the node object")
+	fs.StringVar(&c.Kubelet.NodeName, "node-name", c.Kubelet.NodeName,
+		"Node whose kubelet version is read from the API server when --kubelet-version is unset (also read from $NODE_NAME)")
+
+	fs.StringVar(&c.Plugin.Socket, "plugin-socket", c.Plugin.Socket, "Socket of the default resource, model resources are served next to it")
+	fs.StringVar(&c.Plugin.ResourceName, "resource-name", c.Plugin.ResourceName, "Extended resource advertised for the devices")
+	fs.Var((*listValue)(&c.Plugin.ModelResources), "model-resources",
+		"Comma-separated models advertised as their own resource, e.g. hailo8,hailo8l gives hailo.ai/hailo8 and hailo.ai/hailo8l; other devices stay on --resource-name")
+	fs.StringVar(&c.Plugin.AllocationMode, "allocation-mode", c.Plugin.AllocationMode,
+		"How allocated devices reach the runtime: cdi-devices, cdi-annotations, both, legacy or auto")
+	fs.IntVar(&c.Plugin.RegisterRetries, "register-retries", c.Plugin.RegisterRetries, "Registration attempts per resource")
+	fs.DurationVar(&c.Plugin.RegisterTimeout, "register-timeout", c.Plugin.RegisterTimeout, "Timeout of connecting to kubelet and of one registration")
+	fs.DurationVar(&c.Plugin.RegisterBackoff, "register-backoff", c.Plugin.RegisterBackoff, "Wait between registration attempts, multiplied by the attempt number")
+	fs.DurationVar(&c.Plugin.ServerStartDelay, "server-start-delay", c.Plugin.ServerStartDelay, "Wait after starting the gRPC servers before registering")
+	fs.DurationVar(&c.Plugin.RestartInterval, "restart-interval", c.Plugin.RestartInterval, "How often a failed resource server is restarted")
+
+	fs.Var((*listValue)(&c.Discovery.Backends), "discovery",
+		"Comma-separated device discovery backends tried in order: sysfs, hailortcli, static")
+	fs.StringVar(&c.Discovery.StaticDevices, "static-devices", c.Discovery.StaticDevices, "JSON device list used by the static discovery backend")
+	fs.StringVar(&c.Discovery.Hailortcli, "hailortcli", c.Discovery.Hailortcli, "Path to the hailortcli binary")
+	fs.DurationVar(&c.Discovery.ResyncInterval, "resync-interval", c.Discovery.ResyncInterval, "Full rescan period when no hotplug event arrives")
+	fs.DurationVar(&c.Discovery.HotplugSettle, "hotplug-settle", c.Discovery.HotplugSettle, "How long hotplug events are coalesced before a rescan")
+
+	fs.DurationVar(&c.Health.Interval, "health-interval", c.Health.Interval, "How often devices are health-checked between rescans")
+	fs.Var((*commandValue)(&c.Health.Probe), "health-probe",
+		"Optional per-device health probe command, split like a shell would without expansion; {name}, {dev} and {pci} are substituted")
+	fs.DurationVar(&c.Health.ProbeTimeout, "health-probe-timeout", c.Health.ProbeTimeout, "Timeout of one health probe run")
+	fs.IntVar(&c.Health.FailureThreshold, "health-failure-threshold", c.Health.FailureThreshold,
+		"Consecutive failed health checks before a device is reported unhealthy")
+	fs.IntVar(&c.Health.SuccessThreshold, "health-success-threshold", c.Health.SuccessThreshold,
+		"Consecutive passed health checks before an unhealthy device recovers")
+	fs.StringVar(&c.Health.StatusFile, "health-status-file", c.Health.StatusFile, "Where the per-device health history is written")
+
+	fs.StringVar(&c.CDI.Dir, "cdi-dir", c.CDI.Dir, "Directory the CDI spec is written to")
+	fs.Var((*listValue)(&c.CDI.SpecDirs), "cdi-spec-dirs", "Comma-separated CDI spec directories in increasing priority, checked for specs conflicting with the generated one")
+	fs.Var((*listValue)(&c.CDI.GlobalEnv), "cdi-global-env",
+		"Comma-separated KEY=VALUE templates added to every container; {{.Count}} and {{.Names}} describe the devices allocated to it")
+	fs.Var((*listValue)(&c.CDI.DeviceEnv), "cdi-device-env",
+		"Comma-separated KEY=VALUE templates added per device; device fields such as {{.Index}}, {{.PCIAddress}} and {{.Model}} are available")
+	fs.Var((*listValue)(&c.CDI.Groups), "cdi-groups",
+		"Comma-separated composite CDI devices next to the all device, e.g. pair=hailo0+hailo1")
+	fs.BoolVar(&c.CDI.SwitchGroups, "cdi-switch-groups", c.CDI.SwitchGroups,
+		"Add a composite CDI device per PCIe switch with several Hailo devices behind it")
+	fs.Var((*listValue)(&c.CDI.Injection.Libraries), "hailort-inject-libraries",
+		"Comma-separated host HailoRT libraries or globs mounted read-only into every container, e.g. /usr/lib/libhailort.so*")
+	fs.Var((*listValue)(&c.CDI.Injection.Config), "hailort-inject-config",
+		"Comma-separated host HailoRT config files or directories mounted read-only into every container")
+	fs.Var((*listValue)(&c.CDI.Injection.Sockets), "hailort-inject-sockets",
+		"Comma-separated host hailort_service sockets mounted read-write into every container")
+	fs.Var((*listValue)(&c.CDI.Injection.Firmware), "hailort-inject-firmware",
+		"Comma-separated host firmware files or directories mounted read-only into every container")
+	fs.BoolVar(&c.CDI.Injection.UpdateLdcache, "hailort-inject-update-ldcache", c.CDI.Injection.UpdateLdcache,
+		"Refresh the container's linker cache for the injected library directories")
+	fs.StringVar(&c.CDI.Injection.Ldconfig, "hailort-inject-ldconfig", c.CDI.Injection.Ldconfig,
+		"Host ldconfig run by --hailort-inject-update-ldcache, default /sbin/ldconfig")
+	fs.StringVar(&c.CDI.HostRoot, "host-root", c.CDI.HostRoot,
+		"Where the host filesystem is visible, used to resolve injected HailoRT paths and probe hailort_service")
+
+	fs.Var((*replicasValue)(&c.Sharing.Replicas), "replicas",
+		"Advertise every device as N virtual devices (hailoN::0..N-1): N for all devices, model=N per model, e.g. 2,hailo8=4")
+	fs.BoolVar(&c.Sharing.HailortService, "hailort-service", c.Sharing.HailortService,
+		"Share devices through hailort_service: advertise shared slots that get the service socket instead of /dev/hailoN")
+	fs.StringVar(&c.Sharing.ServiceSocket, "hailort-service-socket", c.Sharing.ServiceSocket,
+		"Host path of the hailort_service unix socket, probed below --host-root")
+	fs.DurationVar(&c.Sharing.ServiceProbeInterval, "hailort-service-probe-interval", c.Sharing.ServiceProbeInterval,
+		"How often hailort_service is checked for liveness")
+
+	return fs
+}
+
+// listValue is a comma-separated flag replacing the whole list
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l = items
+	return nil
+}
+
+// commandValue splits a command line into arguments. Single and double
+// quotes group words and a backslash escapes the next character, but
+// nothing is expanded.
+type commandValue []string
+
+func (c *commandValue) String() string {
+	if c == nil {
+		return ""
+	}
+	quoted := make([]string, len(*c))
+	for i, arg := range *c {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (c *commandValue) Set(value string) error {
+	args, err := splitCommand(value)
+	if err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// splitCommand splits value at unquoted whitespace
+func splitCommand(value string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range value {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", value)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// replicasValue parses --replicas with plugin.ParseReplicas
+type replicasValue Replicas
+
+func (r *replicasValue) String() string {
+	if r == nil {
+		return ""
+	}
+	var entries []string
+	if r.Default > 0 {
+		entries = append(entries, strconv.Itoa(r.Default))
+	}
+	models := make([]string, 0, len(r.Models))
+	for model := range r.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		entries = append(entries, model+"="+strconv.Itoa(r.Models[model]))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (r *replicasValue) Set(value string) error {
+	parsed, err := plugin.ParseReplicas(value)
+	if err != nil {
+		return err
+	}
+	*r = replicasValue{Default: parsed.Default, Models: parsed.PerModel}
+	return nil
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hailo-device-plugin/pkg/cdi"
+)
+
+// env returns a lookup function over a fixed set of variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, opts, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Expected the defaults without file, env or flags, got %+v", cfg)
+	}
+	if opts.Path != "" || opts.Print {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Defaults must be valid: %v", err)
+	}
+}
+
+func TestLoad_File(t *testing.T) {
+	path := filepath.Join("testdata", "config.yaml")
+	cfg, opts, err := Load([]string{"--config", path}, env(nil))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if opts.Path != path {
+		t.Errorf("Expected path %s, got %q", path, opts.Path)
+	}
+
+	if cfg.Kubelet.Socket != "/run/kubelet/device-plugins/kubelet.sock" || cfg.Plugin.RegisterRetries != 3 {
+		t.Errorf("File values not applied: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Plugin.ModelResources, []string{"hailo8", "hailo8l"}) {
+		t.Errorf("Expected normalized models, got %v", cfg.Plugin.ModelResources)
+	}
+	if !reflect.DeepEqual(cfg.Discovery.Backends, []string{"hailortcli", "sysfs"}) || cfg.Discovery.ResyncInterval != 2*time.Minute {
+		t.Errorf("Unexpected discovery: %+v", cfg.Discovery)
+	}
+	if cfg.Sharing.Replicas.Default != 2 || cfg.Sharing.Replicas.Models["hailo8"] != 4 {
+		t.Errorf("Unexpected replicas: %+v", cfg.Sharing.Replicas)
+	}
+	if !reflect.DeepEqual(cfg.Health.Probe, []string{"hailortcli", "fw-control", "identify", "-s", "{pci}"}) {
+		t.Errorf("Unexpected probe: %q", cfg.Health.Probe)
+	}
+	wantInjection := cdi.Injection{
+		Libraries:     []string{"/usr/lib/libhailort.so*"},
+		Sockets:       []string{"/tmp/hailort_uds.sock"},
+		UpdateLdcache: true,
+	}
+	if !reflect.DeepEqual(cfg.CDI.Injection, wantInjection) {
+		t.Errorf("Unexpected injection: %+v", cfg.CDI.Injection)
+	}
+	// Keys missing from the file keep their defaults
+	if cfg.Health.SuccessThreshold != Default().Health.SuccessThreshold || cfg.CDI.Dir != "/etc/cdi" {
+		t.Errorf("Defaults not kept: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config: %v", err)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	vars := map[string]string{
+		EnvName("config"):           filepath.Join("testdata", "config.yaml"),
+		EnvName("allocation-mode"):  "both",
+		EnvName("register-retries"): "7",
+		EnvName("replicas"):         "3",
+		"KUBELET_VERSION":           "v1.31.0",
+		"NODE_NAME":                 "node-1",
+	}
+	cfg, _, err := Load([]string{"--register-retries=9", "--cdi-groups="}, env(vars))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// flag > env > file > default
+	if cfg.Plugin.RegisterRetries != 9 {
+		t.Errorf("Expected the flag to win, got %d", cfg.Plugin.RegisterRetries)
+	}
+	if cfg.Plugin.AllocationMode != "both" {
+		t.Errorf("Expected the env var to override the file, got %q", cfg.Plugin.AllocationMode)
+	}
+	if cfg.Plugin.ResourceName != "example.com/npu" {
+		t.Errorf("Expected the file to override the default, got %q", cfg.Plugin.ResourceName)
+	}
+	if cfg.Sharing.Replicas.Default != 3 || len(cfg.Sharing.Replicas.Models) != 0 {
+		t.Errorf("Expected --replicas to replace the file's replicas, got %+v", cfg.Sharing.Replicas)
+	}
+	if len(cfg.CDI.Groups) != 0 {
+		t.Errorf("Expected an empty flag to clear the list, got %v", cfg.CDI.Groups)
+	}
+	if cfg.Kubelet.Version != "v1.31.0" {
+		t.Errorf("Expected $KUBELET_VERSION to be honoured, got %q", cfg.Kubelet.Version)
+	}
+	if cfg.Kubelet.NodeName != "node-1" {
+		t.Errorf("Expected $NODE_NAME to be honoured, got %q", cfg.Kubelet.NodeName)
+	}
+}
+
+func TestLoad_HealthProbe(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  []string
+	}{
+		{"hailortcli fw-control identify -s {pci}", []string{"hailortcli", "fw-control", "identify", "-s", "{pci}"}},
+		{`/opt/probe --label "Hailo {name}" --dir '/mnt/my disk'`, []string{"/opt/probe", "--label", "Hailo {name}", "--dir", "/mnt/my disk"}},
+		{`check a\ b ""`, []string{"check", "a b", ""}},
+		{"", nil},
+	}
+	for _, tc := range testCases {
+		cfg, _, err := Load([]string{"--health-probe", tc.value}, env(nil))
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", tc.value, err)
+		}
+		if !reflect.DeepEqual(cfg.Health.Probe, tc.want) {
+			t.Errorf("Load(%q): expected %q, got %q", tc.value, tc.want, cfg.Health.Probe)
+		}
+	}
+
+	if _, _, err := Load([]string{"--health-probe", `probe "unterminated`}, env(nil)); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	unknown := filepath.Join(t.TempDir(), "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("plugin:\n  resourcName: hailo.ai/npu\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+		vars map[string]string
+	}{
+		{"unknown key", []string{"--config", unknown}, nil},
+		{"missing file", []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, nil},
+		{"bad env", nil, map[string]string{EnvName("health-interval"): "often"}},
+		{"bad flag", []string{"--replicas=0"}, nil},
+		{"extra argument", []string{"run"}, nil},
+	}
+	for _, tc := range testCases {
+		if _, _, err := Load(tc.args, env(tc.vars)); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestValidate_ReportsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.Plugin.ResourceName = "npu"
+	cfg.Plugin.RegisterRetries = 0
+	cfg.Discovery.Backends = []string{"pcie"}
+	cfg.Health.Interval = 0
+	cfg.CDI.DeviceEnv = []string{"HAILO_X={{.Missing}}"}
+	cfg.CDI.Injection.Firmware = []string{"lib/firmware/hailo"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"plugin.resourceName", "plugin.registerRetries", "discovery.backends", "health.interval", "cdi env", "cdi.injection"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidate_ModelResourcesNeedFirmware(t *testing.T) {
+	testCases := []struct {
+		backends []string
+		models   []string
+		valid    bool
+	}{
+		{[]string{"sysfs"}, []string{"hailo10h"}, true},
+		{[]string{"sysfs"}, []string{"hailo8l"}, false},
+		{[]string{"sysfs"}, []string{"hailo8"}, false},
+		{[]string{"hailortcli", "sysfs"}, []string{"hailo8", "hailo8l"}, true},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.Discovery.Backends = tc.backends
+		cfg.Plugin.ModelResources = tc.models
+		err := cfg.Validate()
+		if (err == nil) != tc.valid {
+			t.Errorf("Models %v with %v: expected valid=%v, got %v", tc.models, tc.backends, tc.valid, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "firmware") {
+			t.Errorf("Expected the error to name the firmware requirement, got %v", err)
+		}
+	}
+}
+
+func TestYAML_RoundTrip(t *testing.T) {
+	cfg, _, err := Load([]string{"--config", filepath.Join("testdata", "config.yaml")}, env(nil))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	data, err := cfg.YAML()
+	if err != nil {
+		t.Fatalf("YAML failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "printed.yaml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _, err := Load([]string{"--config", path}, env(nil))
+	if err != nil {
+		t.Fatalf("Printed config does not load: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(cfg, reloaded) {
+		t.Errorf("Printed config differs after reload:\n%s", data)
+	}
+}
@@ -0,0 +1,80 @@
+package device
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HailoVendorID is the PCI vendor ID of Hailo Technologies
+const HailoVendorID = "1e60"
+
+// Device describes a single Hailo PCIe device found on the host
+type Device struct {
+	// Name is the char-dev name under /sys/class/hailo_chardev (e.g. hailo0)
+	Name string
+	// Index is the numeric suffix of Name, or -1 if the name has none
+	Index int
+	// DevPath is the host device node (e.g. /dev/hailo0)
+	DevPath string
+	// PCIAddress is the PCI bus/device/function address (e.g. 0000:01:00.0)
+	PCIAddress string
+	// VendorID and DeviceID are the PCI IDs in lowercase hex without 0x prefix
+	VendorID string
+	DeviceID string
+	// Major and Minor are the char-dev numbers reported by the kernel
+	Major uint32
+	Minor uint32
+	// Driver is the kernel driver bound to the PCI function, empty if unbound
+	Driver string
+	// NoSysfs marks devices sysfs does not describe, such as the entries of
+	// a static device list
+	NoSysfs bool
+
+	// NUMANode is the NUMA node of the PCI function, -1 if unknown
+	NUMANode int
+	// PCIPath lists the upstream bridges from the root port down to the
+	// device's parent; devices behind one PCIe switch share a prefix
+	PCIPath []string
+
+	// Firmware identify data, empty when the backend cannot query the board
+	FirmwareVersion string
+	Architecture    string
+	BoardName       string
+	SerialNumber    string
+
+	// Model is the board model such as hailo8 or hailo8l, empty if unknown
+	Model string
+}
+
+// New returns a Device with the name-derived fields filled in
+func New(name string) Device {
+	return Device{
+		Name:     name,
+		Index:    IndexFromName(name),
+		DevPath:  filepath.Join("/dev", name),
+		NUMANode: -1,
+	}
+}
+
+// IndexFromName extracts the trailing number of a device name (hailo3 -> 3)
+func IndexFromName(name string) int {
+	digits := strings.TrimLeft(name, "abcdefghijklmnopqrstuvwxyz_-")
+	if digits == "" || len(digits) == len(name) {
+		return -1
+	}
+	idx, err := strconv.Atoi(digits)
+	if err != nil {
+		return -1
+	}
+	return idx
+}
+
+// Names returns the names of the given devices in order
+func Names(devices []Device) []string {
+	names := make([]string, 0, len(devices))
+	for _, d := range devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
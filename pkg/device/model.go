@@ -0,0 +1,49 @@
+package device
+
+import "strings"
+
+// Board models, as used in resource names and the CDI spec
+const (
+	ModelHailo8   = "hailo8"
+	ModelHailo8L  = "hailo8l"
+	ModelHailo10H = "hailo10h"
+)
+
+// pciModels maps PCI device IDs that identify a single board model
+var pciModels = map[string]string{
+	"45c4": ModelHailo10H,
+}
+
+// firmwareModels share PCI device ID 2864, only their firmware tells them apart
+var firmwareModels = map[string]bool{
+	ModelHailo8:  true,
+	ModelHailo8L: true,
+}
+
+// DetectModel identifies the board model from the firmware identify data,
+// falling back to the PCI device ID. It returns "" when neither is known,
+// which includes a Hailo-8 or Hailo-8L without firmware data.
+func DetectModel(dev Device) string {
+	if model := NormalizeModel(dev.Architecture); model != "" {
+		return model
+	}
+	return pciModels[strings.ToLower(dev.DeviceID)]
+}
+
+// RequiresFirmware reports whether a model can only be detected from the
+// firmware identify data, not from the PCI device ID
+func RequiresFirmware(model string) bool {
+	return firmwareModels[NormalizeModel(model)]
+}
+
+// NormalizeModel turns an architecture or model name such as HAILO8L or
+// Hailo-8L into the lowercase form used in resource names (hailo8l)
+func NormalizeModel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
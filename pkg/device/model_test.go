@@ -0,0 +1,36 @@
+package device
+
+import "testing"
+
+func TestDetectModel(t *testing.T) {
+	testCases := []struct {
+		deviceID     string
+		architecture string
+		expected     string
+	}{
+		// Hailo-8L shares the Hailo-8 PCI ID, so the ID alone is ambiguous
+		{"2864", "", ""},
+		{"2864", "HAILO8", ModelHailo8},
+		{"2864", "HAILO8L", ModelHailo8L},
+		{"45C4", "", ModelHailo10H},
+		{"", "HAILO10H", ModelHailo10H},
+		{"", "Hailo-8L", ModelHailo8L},
+		{"1234", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tc := range testCases {
+		dev := Device{DeviceID: tc.deviceID, Architecture: tc.architecture}
+		if got := DetectModel(dev); got != tc.expected {
+			t.Errorf("DetectModel(%q, %q): expected %q, got %q", tc.deviceID, tc.architecture, tc.expected, got)
+		}
+	}
+}
+
+func TestRequiresFirmware(t *testing.T) {
+	for model, expected := range map[string]bool{"hailo8": true, "Hailo-8L": true, "hailo10h": false, "": false} {
+		if got := RequiresFirmware(model); got != expected {
+			t.Errorf("RequiresFirmware(%q): expected %v, got %v", model, expected, got)
+		}
+	}
+}
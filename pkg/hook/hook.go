@@ -0,0 +1,52 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// Command is the subcommand of the plugin binary that runs CDI hooks
+	Command = "hailo-cdi-hook"
+	// DefaultRoot holds the installed hook binary and the legacy mode's chardev directories
+	DefaultRoot = "/var/lib/hailo-cdi"
+	// DefaultBinary is where the plugin installs itself for the runtime to execute
+	DefaultBinary = DefaultRoot + "/hailo-device-plugin"
+
+	// StageCreateContainer is the OCI stage the ldcache hook runs in
+	StageCreateContainer = "createContainer"
+)
+
+// State is the part of the OCI container state passed to hooks on stdin
+type State struct {
+	Version     string            `json:"ociVersion"`
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Pid         int               `json:"pid,omitempty"`
+	Bundle      string            `json:"bundle"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ReadState decodes the OCI state and checks that it names a bundle
+func ReadState(r io.Reader) (*State, error) {
+	var state State
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode OCI state: %w", err)
+	}
+	if state.Bundle == "" {
+		return nil, fmt.Errorf("OCI state of container %q has no bundle", state.ID)
+	}
+	return &state, nil
+}
+
+// Hook runs the CDI hooks referenced by the generated spec
+type Hook struct {
+	// Run executes external commands, nil runs them directly
+	Run CommandRunner
+}
+
+// New creates a hook running commands directly
+func New() *Hook {
+	return &Hook{}
+}
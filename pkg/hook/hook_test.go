@@ -0,0 +1,49 @@
+package hook
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func stateJSON(id, bundle string) string {
+	return `{"ociVersion":"1.0.2","id":"` + id + `","status":"created","bundle":"` + bundle + `"}`
+}
+
+func TestMain_UpdateLdcache(t *testing.T) {
+	state, root := newBundle(t)
+	// A missing ldconfig fails the hook after the folders were registered
+	ldconfig := filepath.Join(t.TempDir(), "ldconfig")
+
+	var stderr bytes.Buffer
+	args := []string{ActionUpdateLdcache, "--ldconfig", ldconfig, "--folder", "/usr/lib"}
+	if code := Main(args, strings.NewReader(stateJSON(state.ID, state.Bundle)), &stderr); code != 1 {
+		t.Fatalf("Expected exit code 1 without ldconfig, got %d: %s", code, stderr.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(root, ldconfigFile)); err != nil || !strings.HasSuffix(string(data), "/usr/lib\n") {
+		t.Errorf("Unexpected ld.so.conf.d entry %q (%v)", data, err)
+	}
+}
+
+func TestMain_RejectsBadInput(t *testing.T) {
+	bundle := t.TempDir()
+	testCases := []struct {
+		args  []string
+		state string
+	}{
+		{[]string{"poststop"}, stateJSON("aaa", bundle)},
+		{[]string{ActionUpdateLdcache, "--folder", "usr/lib"}, stateJSON("aaa", bundle)},
+		{[]string{ActionUpdateLdcache, "--folder", "/usr/lib"}, "not json"},
+		{[]string{ActionUpdateLdcache, "--folder", "/usr/lib"}, stateJSON("aaa", "")},
+		{nil, stateJSON("aaa", bundle)},
+	}
+
+	for _, tc := range testCases {
+		var stderr bytes.Buffer
+		if code := Main(tc.args, strings.NewReader(tc.state), &stderr); code == 0 {
+			t.Errorf("Expected failure for args %v and state %q", tc.args, tc.state)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ActionUpdateLdcache refreshes the linker cache of a container
+	ActionUpdateLdcache = "update-ldcache"
+	// DefaultLdconfig is the host ldconfig run by the ldcache hook
+	DefaultLdconfig = "/sbin/ldconfig"
+
+	// ldconfigFile lists the injected library folders inside the container
+	ldconfigFile = "etc/ld.so.conf.d/00-hailo-cdi.conf"
+)
+
+// CommandRunner runs a command and returns its combined output
+type CommandRunner func(name string, args ...string) ([]byte, error)
+
+func execRunner(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// LdcacheArgs returns the hook arguments, including argv[0], updating the
+// linker cache for folders with the host's ldconfig
+func LdcacheArgs(ldconfig string, folders []string) []string {
+	args := []string{filepath.Base(DefaultBinary), Command, ActionUpdateLdcache, "--ldconfig", ldconfig}
+	for _, folder := range folders {
+		args = append(args, "--folder", folder)
+	}
+	return args
+}
+
+// bundleConfig is the part of the OCI runtime config the hook needs
+type bundleConfig struct {
+	Root struct {
+		Path string `json:"path"`
+	} `json:"root"`
+}
+
+// rootfs returns the container's root filesystem from its bundle
+func rootfs(state *State) (string, error) {
+	data, err := os.ReadFile(filepath.Join(state.Bundle, "config.json"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle config: %w", err)
+	}
+	var config bundleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("failed to parse bundle config: %w", err)
+	}
+	if config.Root.Path == "" {
+		return "", fmt.Errorf("bundle config has no root path")
+	}
+	if filepath.IsAbs(config.Root.Path) {
+		return config.Root.Path, nil
+	}
+	return filepath.Join(state.Bundle, config.Root.Path), nil
+}
+
+// UpdateLdcache registers folders with the container's dynamic linker and
+// rebuilds its cache with the host ldconfig, chrooted into the container's root
+func (h *Hook) UpdateLdcache(state *State, ldconfig string, folders []string) error {
+	root, err := rootfs(state)
+	if err != nil {
+		return err
+	}
+
+	conf := filepath.Join(root, ldconfigFile)
+	if err := checkNoSymlinks(root, ldconfigFile); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(conf), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(conf), err)
+	}
+	content := "# Generated by " + Command + "\n" + strings.Join(folders, "\n") + "\n"
+	if err := os.WriteFile(conf, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", conf, err)
+	}
+
+	run := h.Run
+	if run == nil {
+		run = execRunner
+	}
+	if out, err := run(ldconfig, "-r", root); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", ldconfig, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkNoSymlinks refuses to follow symlinks below root, which an image
+// could use to point the hook's writes at host files
+func checkNoSymlinks(root, rel string) error {
+	path := root
+	for _, part := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to follow symlink %s in the container root", path)
+		}
+	}
+	return nil
+}
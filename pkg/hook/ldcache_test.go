@@ -0,0 +1,75 @@
+package hook
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newBundle creates an OCI bundle with a rootfs directory
+func newBundle(t *testing.T) (*State, string) {
+	t.Helper()
+	bundle := t.TempDir()
+	root := filepath.Join(bundle, "rootfs")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "config.json"), []byte(`{"root": {"path": "rootfs"}}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return &State{ID: "hhh", Bundle: bundle}, root
+}
+
+func TestUpdateLdcache(t *testing.T) {
+	state, root := newBundle(t)
+
+	var calls [][]string
+	h := New()
+	h.Run = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return nil, nil
+	}
+
+	if err := h.UpdateLdcache(state, "/sbin/ldconfig", []string{"/usr/lib", "/opt/hailo/lib"}); err != nil {
+		t.Fatalf("UpdateLdcache failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, ldconfigFile))
+	if err != nil || !strings.HasSuffix(string(data), "/usr/lib\n/opt/hailo/lib\n") {
+		t.Errorf("Unexpected ld.so.conf.d entry %q (%v)", data, err)
+	}
+	if expected := [][]string{{"/sbin/ldconfig", "-r", root}}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected ldconfig calls %v, got %v", expected, calls)
+	}
+}
+
+func TestUpdateLdcache_RefusesSymlinks(t *testing.T) {
+	state, root := newBundle(t)
+	target := t.TempDir()
+	if err := os.Symlink(target, filepath.Join(root, "etc", "ld.so.conf.d")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	h := New()
+	h.Run = func(string, ...string) ([]byte, error) { return nil, nil }
+	if err := h.UpdateLdcache(state, "/sbin/ldconfig", []string{"/usr/lib"}); err == nil {
+		t.Error("Expected a symlinked ld.so.conf.d to be refused")
+	}
+	if entries, _ := os.ReadDir(target); len(entries) != 0 {
+		t.Error("Hook wrote through a symlink out of the container root")
+	}
+}
+
+func TestUpdateLdcache_LdconfigFailure(t *testing.T) {
+	state, _ := newBundle(t)
+	h := New()
+	h.Run = func(string, ...string) ([]byte, error) { return []byte("bad cache"), errors.New("exit status 1") }
+
+	err := h.UpdateLdcache(state, "/sbin/ldconfig", []string{"/usr/lib"})
+	if err == nil || !strings.Contains(err.Error(), "bad cache") {
+		t.Errorf("Expected ldconfig output in the error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package hook
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Main runs the hook subcommand, args excludes the subcommand name.
+// It returns the process exit code.
+func Main(args []string, stdin io.Reader, stderr io.Writer) int {
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ldconfig := flags.String("ldconfig", DefaultLdconfig, "Host ldconfig used by "+ActionUpdateLdcache)
+	var folders folderList
+	flags.Var(&folders, "folder", "Library folder registered by "+ActionUpdateLdcache+", may be repeated")
+
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, "usage: %s %s [flags]\n", Command, ActionUpdateLdcache)
+		return 2
+	}
+	action := args[0]
+	if action != ActionUpdateLdcache {
+		fmt.Fprintf(stderr, "%s: unknown action %q\n", Command, action)
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	state, err := ReadState(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", Command, err)
+		return 1
+	}
+	if err := New().UpdateLdcache(state, *ldconfig, folders); err != nil {
+		fmt.Fprintf(stderr, "%s %s for container %s: %v\n", Command, action, state.ID, err)
+		return 1
+	}
+	return 0
+}
+
+// folderList collects repeated --folder flags
+type folderList []string
+
+func (f *folderList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *folderList) Set(value string) error {
+	if !filepath.IsAbs(value) || strings.ContainsAny(value, "\n\x00") {
+		return fmt.Errorf("%q is not an absolute path", value)
+	}
+	*f = append(*f, filepath.Clean(value))
+	return nil
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"reflect"
+	"sync"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// DeviceState is a discovered device together with its current health
+type DeviceState struct {
+	device.Device
+	Healthy bool
+	// Reason explains why the device is unhealthy, empty when healthy
+	Reason string
+}
+
+// Snapshot is an immutable view of the device inventory
+type Snapshot struct {
+	// Generation increases by one for every published change
+	Generation uint64
+	Devices    []DeviceState
+}
+
+// Lookup returns the state of the named device
+func (s Snapshot) Lookup(name string) (DeviceState, bool) {
+	for _, d := range s.Devices {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DeviceState{}, false
+}
+
+// Broadcaster fans device snapshots out to any number of subscribers.
+// Only changes are delivered, and a slow subscriber only ever sees the
+// latest snapshot instead of blocking the publisher.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Snapshot]struct{}
+	latest      Snapshot
+	published   bool
+}
+
+// NewBroadcaster creates a broadcaster with no snapshot yet
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan Snapshot]struct{}),
+	}
+}
+
+// Publish records a new device set and delivers it to every subscriber.
+// It returns false without notifying anyone when nothing changed.
+func (b *Broadcaster) Publish(devices []DeviceState) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.published && reflect.DeepEqual(b.latest.Devices, devices) {
+		return false
+	}
+
+	b.latest = Snapshot{
+		Generation: b.latest.Generation + 1,
+		Devices:    append([]DeviceState(nil), devices...),
+	}
+	b.published = true
+
+	for ch := range b.subscribers {
+		deliver(ch, b.latest)
+	}
+	return true
+}
+
+// Subscribe returns a channel that immediately receives the latest snapshot,
+// if any, followed by every change. The returned function unsubscribes.
+func (b *Broadcaster) Subscribe() (<-chan Snapshot, func()) {
+	ch := make(chan Snapshot, 1)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	if b.published {
+		deliver(ch, b.latest)
+	}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Latest returns the most recent snapshot and whether one was published
+func (b *Broadcaster) Latest() (Snapshot, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latest, b.published
+}
+
+// deliver replaces any undelivered snapshot with the new one.
+// Callers hold the broadcaster lock, so no other sender can race.
+func deliver(ch chan Snapshot, snap Snapshot) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- snap
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+func healthyStates(names ...string) []DeviceState {
+	states := make([]DeviceState, 0, len(names))
+	for _, name := range names {
+		states = append(states, DeviceState{Device: device.New(name), Healthy: true})
+	}
+	return states
+}
+
+func TestBroadcaster_PublishOnlyChanges(t *testing.T) {
+	b := NewBroadcaster()
+
+	if !b.Publish(healthyStates("hailo0")) {
+		t.Error("First publish should report a change")
+	}
+	if b.Publish(healthyStates("hailo0")) {
+		t.Error("Identical device set should not be published again")
+	}
+
+	unhealthy := healthyStates("hailo0")
+	unhealthy[0].Healthy = false
+	if !b.Publish(unhealthy) {
+		t.Error("Health change should be published")
+	}
+
+	snap, ok := b.Latest()
+	if !ok || snap.Generation != 2 {
+		t.Errorf("Expected generation 2, got %d (published %v)", snap.Generation, ok)
+	}
+}
+
+func TestBroadcaster_FanOut(t *testing.T) {
+	b := NewBroadcaster()
+	b.Publish(healthyStates("hailo0"))
+
+	first, unsubscribeFirst := b.Subscribe()
+	second, unsubscribeSecond := b.Subscribe()
+	defer unsubscribeSecond()
+
+	// New subscribers start with the current snapshot
+	for i, ch := range []<-chan Snapshot{first, second} {
+		select {
+		case snap := <-ch:
+			if len(snap.Devices) != 1 {
+				t.Errorf("Subscriber %d got unexpected initial snapshot %+v", i, snap)
+			}
+		default:
+			t.Errorf("Subscriber %d did not receive the initial snapshot", i)
+		}
+	}
+
+	unsubscribeFirst()
+	b.Publish(healthyStates("hailo0", "hailo1"))
+
+	select {
+	case <-first:
+		t.Error("Unsubscribed channel should not receive updates")
+	default:
+	}
+	select {
+	case snap := <-second:
+		if len(snap.Devices) != 2 {
+			t.Errorf("Expected 2 devices, got %+v", snap.Devices)
+		}
+	default:
+		t.Error("Remaining subscriber did not receive the update")
+	}
+}
+
+func TestBroadcaster_SlowSubscriberSeesLatest(t *testing.T) {
+	b := NewBroadcaster()
+	updates, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	// Publishing must not block on a subscriber that is not reading
+	b.Publish(healthyStates("hailo0"))
+	b.Publish(healthyStates("hailo0", "hailo1"))
+	b.Publish(healthyStates("hailo0", "hailo1", "hailo2"))
+
+	snap := <-updates
+	if snap.Generation != 3 || len(snap.Devices) != 3 {
+		t.Errorf("Expected only the latest snapshot, got generation %d", snap.Generation)
+	}
+	select {
+	case <-updates:
+		t.Error("Stale snapshots should have been replaced")
+	default:
+	}
+}
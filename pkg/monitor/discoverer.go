@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// Discoverer finds Hailo devices present on the host
+type Discoverer interface {
+	// Name identifies the backend in logs and on the command line
+	Name() string
+	// Discover returns the devices currently present, sorted by index
+	Discover() ([]device.Device, error)
+}
+
+var (
+	_ Discoverer = (*SysfsDiscoverer)(nil)
+	_ Discoverer = (*HailortcliDiscoverer)(nil)
+	_ Discoverer = (*StaticDiscoverer)(nil)
+	_ Discoverer = (*ChainDiscoverer)(nil)
+)
+
+// DiscovererOptions holds the settings used to build discovery backends
+type DiscovererOptions struct {
+	SysfsRoot      string
+	HailortcliPath string
+	StaticPath     string
+}
+
+// NewDiscoverer builds a discoverer from a comma-separated backend list.
+// A single name returns that backend, several names chain them with fallback.
+func NewDiscoverer(spec string, opts DiscovererOptions) (Discoverer, error) {
+	var backends []Discoverer
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		switch name {
+		case "sysfs":
+			backends = append(backends, NewSysfsDiscoverer(opts.SysfsRoot))
+		case "hailortcli":
+			backends = append(backends, NewHailortcliDiscoverer(opts.HailortcliPath, opts.SysfsRoot))
+		case "static":
+			if opts.StaticPath == "" {
+				return nil, fmt.Errorf("static discovery requires a device list file")
+			}
+			backends = append(backends, NewStaticDiscoverer(opts.StaticPath))
+		default:
+			return nil, fmt.Errorf("unknown discovery backend %q (want sysfs, hailortcli or static)", name)
+		}
+	}
+
+	switch len(backends) {
+	case 0:
+		return nil, fmt.Errorf("no discovery backend selected")
+	case 1:
+		return backends[0], nil
+	default:
+		return &ChainDiscoverer{Discoverers: backends}, nil
+	}
+}
+
+// ChainDiscoverer tries each backend in order and returns the first
+// non-empty result, so a richer backend can fall back to a simpler one
+type ChainDiscoverer struct {
+	Discoverers []Discoverer
+}
+
+// Name returns the chained backend names joined by commas
+func (c *ChainDiscoverer) Name() string {
+	names := make([]string, 0, len(c.Discoverers))
+	for _, d := range c.Discoverers {
+		names = append(names, d.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Discover returns the devices from the first backend that finds any.
+// Errors are only returned when every backend failed.
+func (c *ChainDiscoverer) Discover() ([]device.Device, error) {
+	var errs []error
+	for _, d := range c.Discoverers {
+		devices, err := d.Discover()
+		if err != nil {
+			log.Printf("Discovery backend %s failed: %v", d.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name(), err))
+			continue
+		}
+		if len(devices) > 0 {
+			return devices, nil
+		}
+		log.Printf("Discovery backend %s found no devices, trying next", d.Name())
+	}
+
+	if len(errs) == len(c.Discoverers) {
+		return nil, errors.Join(errs...)
+	}
+	return []device.Device{}, nil
+}
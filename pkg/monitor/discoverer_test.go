@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// fakeDiscoverer returns canned results for chain tests
+type fakeDiscoverer struct {
+	name    string
+	devices []device.Device
+	err     error
+	calls   int
+}
+
+func (f *fakeDiscoverer) Name() string { return f.name }
+
+func (f *fakeDiscoverer) Discover() ([]device.Device, error) {
+	f.calls++
+	return f.devices, f.err
+}
+
+func TestStaticDiscoverer_Discover(t *testing.T) {
+	d := NewStaticDiscoverer(filepath.Join("testdata", "static", "devices.json"))
+
+	devices, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d", len(devices))
+	}
+	if devices[0].Name != "hailo0" || devices[0].DevPath != "/dev/hailo0" {
+		t.Errorf("Expected devices sorted by index, got %+v", devices[0])
+	}
+	if devices[0].FirmwareVersion != "4.23.0" || devices[1].Minor != 1 {
+		t.Errorf("Fields not copied from file: %+v", devices)
+	}
+	if devices[1].Model != device.ModelHailo8L {
+		t.Errorf("Expected the model override to be normalized, got %q", devices[1].Model)
+	}
+}
+
+func TestStaticDiscoverer_MissingFile(t *testing.T) {
+	d := NewStaticDiscoverer(filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := d.Discover(); err == nil {
+		t.Error("Expected error for missing static device list")
+	}
+}
+
+func TestChainDiscoverer_FallsBackOnEmptyAndError(t *testing.T) {
+	failing := &fakeDiscoverer{name: "a", err: errors.New("boom")}
+	empty := &fakeDiscoverer{name: "b", devices: []device.Device{}}
+	working := &fakeDiscoverer{name: "c", devices: []device.Device{device.New("hailo0")}}
+	unused := &fakeDiscoverer{name: "d", devices: []device.Device{device.New("hailo9")}}
+
+	chain := &ChainDiscoverer{Discoverers: []Discoverer{failing, empty, working, unused}}
+	devices, err := chain.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "hailo0" {
+		t.Errorf("Expected result of third backend, got %+v", devices)
+	}
+	if unused.calls != 0 {
+		t.Error("Backends after the first successful one should not be called")
+	}
+	if chain.Name() != "a,b,c,d" {
+		t.Errorf("Unexpected chain name %q", chain.Name())
+	}
+}
+
+func TestChainDiscoverer_AllFail(t *testing.T) {
+	chain := &ChainDiscoverer{Discoverers: []Discoverer{
+		&fakeDiscoverer{name: "a", err: errors.New("first")},
+		&fakeDiscoverer{name: "b", err: errors.New("second")},
+	}}
+	if _, err := chain.Discover(); err == nil {
+		t.Error("Expected error when every backend fails")
+	}
+}
+
+func TestNewDiscoverer(t *testing.T) {
+	opts := DiscovererOptions{SysfsRoot: t.TempDir(), StaticPath: "devices.json"}
+
+	d, err := NewDiscoverer("sysfs", opts)
+	if err != nil || d.Name() != "sysfs" {
+		t.Errorf("Expected sysfs backend, got %v (err %v)", d, err)
+	}
+
+	d, err = NewDiscoverer("hailortcli, sysfs, static", opts)
+	if err != nil {
+		t.Fatalf("Failed to build chain: %v", err)
+	}
+	if _, ok := d.(*ChainDiscoverer); !ok || d.Name() != "hailortcli,sysfs,static" {
+		t.Errorf("Expected chained backend, got %s", d.Name())
+	}
+
+	if _, err := NewDiscoverer("pcie", opts); err == nil {
+		t.Error("Expected error for unknown backend")
+	}
+	if _, err := NewDiscoverer("static", DiscovererOptions{}); err == nil {
+		t.Error("Expected error for static backend without a file")
+	}
+}
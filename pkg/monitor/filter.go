@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"context"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// Source delivers device snapshots, such as a ResourceMonitor or Broadcaster
+type Source interface {
+	Subscribe() (<-chan Snapshot, func())
+}
+
+// Filter republishes the devices of source that match, so a plugin instance
+// serving one model only sees its own devices. Changes to other devices are
+// not delivered. The filter stops when ctx is cancelled.
+func Filter(ctx context.Context, source Source, match func(device.Device) bool) *Broadcaster {
+	filtered := NewBroadcaster()
+	updates, unsubscribe := source.Subscribe()
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case snap := <-updates:
+				states := make([]DeviceState, 0, len(snap.Devices))
+				for _, d := range snap.Devices {
+					if match(d.Device) {
+						states = append(states, d)
+					}
+				}
+				filtered.Publish(states)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return filtered
+}
+
+// MatchModels selects the devices of the given models
+func MatchModels(models ...string) func(device.Device) bool {
+	return func(d device.Device) bool {
+		for _, model := range models {
+			if d.Model == model {
+				return true
+			}
+		}
+		return false
+	}
+}
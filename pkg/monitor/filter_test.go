@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+func TestFilter_OnlyDeliversMatchingChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	states := healthyStates("hailo0", "hailo1")
+	states[0].Model = device.ModelHailo8
+	states[1].Model = device.ModelHailo8L
+
+	source := NewBroadcaster()
+	source.Publish(states)
+
+	filtered := Filter(ctx, source, MatchModels(device.ModelHailo8L))
+	updates, unsubscribe := filtered.Subscribe()
+	defer unsubscribe()
+
+	snap := receive(t, updates)
+	if len(snap.Devices) != 1 || snap.Devices[0].Name != "hailo1" {
+		t.Fatalf("Expected only hailo1, got %v", snap.Devices)
+	}
+
+	// A change to a device of another model is not a change of the filtered set
+	other := append([]DeviceState(nil), states...)
+	other[0].Healthy = false
+	source.Publish(other)
+
+	own := append([]DeviceState(nil), other...)
+	own[1].Healthy = false
+	source.Publish(own)
+
+	snap = receive(t, updates)
+	if snap.Generation != 2 || snap.Devices[0].Healthy {
+		t.Errorf("Expected the hailo1 health change as generation 2, got %+v", snap)
+	}
+}
+
+func receive(t *testing.T, updates <-chan Snapshot) Snapshot {
+	t.Helper()
+	select {
+	case snap := <-updates:
+		return snap
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a snapshot")
+		return Snapshot{}
+	}
+}
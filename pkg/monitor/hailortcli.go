@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+const (
+	// DefaultHailortcliPath is looked up in $PATH
+	DefaultHailortcliPath = "hailortcli"
+
+	hailortcliTimeout = 10 * time.Second
+)
+
+// pciAddressPattern matches a full PCI address such as 0000:01:00.0
+var pciAddressPattern = regexp.MustCompile(`\b[0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]\b`)
+
+// CommandRunner executes a command and returns its stdout
+type CommandRunner func(name string, args ...string) ([]byte, error)
+
+// HailortcliDiscoverer finds devices with `hailortcli scan` and enriches them
+// with firmware data from `hailortcli fw-control identify`
+type HailortcliDiscoverer struct {
+	// Path is the hailortcli binary
+	Path string
+	// SysfsRoot is used to map PCI addresses to char-dev names
+	SysfsRoot string
+	// Run executes hailortcli, replaceable with recorded output in tests
+	Run CommandRunner
+}
+
+// NewHailortcliDiscoverer creates a discoverer that shells out to hailortcli
+func NewHailortcliDiscoverer(path, sysfsRoot string) *HailortcliDiscoverer {
+	if path == "" {
+		path = DefaultHailortcliPath
+	}
+	if sysfsRoot == "" {
+		sysfsRoot = DefaultSysfsRoot
+	}
+	return &HailortcliDiscoverer{
+		Path:      path,
+		SysfsRoot: sysfsRoot,
+		Run:       runCommand,
+	}
+}
+
+// Name returns the backend name
+func (d *HailortcliDiscoverer) Name() string {
+	return "hailortcli"
+}
+
+// Discover scans for devices and identifies each of them.
+// A failing identify leaves the firmware fields empty but keeps the device.
+// Devices without a hailo_chardev entry in sysfs are skipped, since their
+// /dev node cannot be told from the scan output.
+func (d *HailortcliDiscoverer) Discover() ([]device.Device, error) {
+	output, err := d.Run(d.Path, "scan")
+	if err != nil {
+		return nil, fmt.Errorf("hailortcli scan failed: %w", err)
+	}
+
+	addresses := ParseScanOutput(output)
+	devices := make([]device.Device, 0, len(addresses))
+	for _, bdf := range addresses {
+		name, err := d.chardevName(bdf)
+		if err != nil {
+			log.Printf("Warning: skipping %s found by hailortcli: %v", bdf, err)
+			continue
+		}
+		dev := device.New(name)
+		dev.PCIAddress = bdf
+		dev.VendorID = device.HailoVendorID
+		// Scan output lacks the PCI device ID the model fallback needs
+		if id, err := readHexID(filepath.Join(d.SysfsRoot, "bus", "pci", "devices", bdf, "device")); err == nil {
+			dev.DeviceID = id
+		}
+
+		identify, err := d.Run(d.Path, "fw-control", "identify", "-s", bdf)
+		if err != nil {
+			log.Printf("Warning: hailortcli identify failed for %s: %v", bdf, err)
+		} else {
+			ApplyIdentifyOutput(&dev, identify)
+		}
+
+		devices = append(devices, dev)
+	}
+
+	return devices, nil
+}
+
+// chardevName maps a PCI address to its hailo_chardev entry, looked up below
+// the PCI function or through the device links of the class directory
+func (d *HailortcliDiscoverer) chardevName(bdf string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(d.SysfsRoot, "bus", "pci", "devices", bdf, "hailo_chardev", "*"))
+	if err == nil && len(matches) > 0 {
+		return filepath.Base(matches[0]), nil
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(d.SysfsRoot, hailoClassDir))
+	for _, entry := range entries {
+		pciDir, err := filepath.EvalSymlinks(filepath.Join(d.SysfsRoot, hailoClassDir, entry.Name(), "device"))
+		if err == nil && filepath.Base(pciDir) == bdf {
+			return entry.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no hailo_chardev entry for %s in sysfs", bdf)
+}
+
+// ParseScanOutput extracts PCI addresses from `hailortcli scan` output in order.
+// Both the "[-] Device: <bdf>" and the older "[0] PCIe: <bdf>" formats are accepted.
+func ParseScanOutput(output []byte) []string {
+	var addresses []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		bdf := pciAddressPattern.FindString(scanner.Text())
+		if bdf == "" {
+			continue
+		}
+		bdf = strings.ToLower(bdf)
+		if !seen[bdf] {
+			seen[bdf] = true
+			addresses = append(addresses, bdf)
+		}
+	}
+	return addresses
+}
+
+// ParseIdentifyOutput turns the "Key: Value" lines of
+// `hailortcli fw-control identify` into a map
+func ParseIdentifyOutput(output []byte) map[string]string {
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key != "" && value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// ApplyIdentifyOutput copies the firmware fields of an identify run into dev
+func ApplyIdentifyOutput(dev *device.Device, output []byte) {
+	fields := ParseIdentifyOutput(output)
+
+	// "4.23.0 (release,app,extended context switch buffer)" -> "4.23.0"
+	if fw, ok := fields["Firmware Version"]; ok {
+		dev.FirmwareVersion = strings.Fields(fw)[0]
+	}
+	dev.Architecture = fields["Device Architecture"]
+	dev.BoardName = fields["Board Name"]
+	dev.SerialNumber = fields["Serial Number"]
+}
+
+// runCommand executes a command with the hailortcli timeout
+func runCommand(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hailortcliTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
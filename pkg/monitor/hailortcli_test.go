@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureRunner replays recorded hailortcli output from testdata
+func fixtureRunner(t *testing.T, scanFixture string) CommandRunner {
+	t.Helper()
+	return func(name string, args ...string) ([]byte, error) {
+		switch {
+		case len(args) == 1 && args[0] == "scan":
+			return os.ReadFile(filepath.Join("testdata", "hailortcli", scanFixture))
+		case len(args) == 4 && args[0] == "fw-control" && args[1] == "identify":
+			fixture := "identify-" + strings.ReplaceAll(args[3], ":", "_") + ".txt"
+			return os.ReadFile(filepath.Join("testdata", "hailortcli", fixture))
+		}
+		return nil, errors.New("unexpected command: " + name + " " + strings.Join(args, " "))
+	}
+}
+
+func TestParseScanOutput(t *testing.T) {
+	testCases := []struct {
+		fixture  string
+		expected []string
+	}{
+		{"scan.txt", []string{"0000:01:00.0", "0000:02:00.0"}},
+		{"scan-legacy.txt", []string{"0000:01:00.0"}},
+		{"scan-empty.txt", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "hailortcli", tc.fixture))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+
+			got := ParseScanOutput(data)
+			if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestHailortcliDiscoverer_Discover(t *testing.T) {
+	root := t.TempDir()
+	mustMkdir(t, filepath.Join(root, "bus", "pci", "devices", "0000:01:00.0", "hailo_chardev", "hailo0"))
+	// Older drivers only link the class entry to its PCI function
+	pciDir := filepath.Join(root, "bus", "pci", "devices", "0000:02:00.0")
+	mustMkdir(t, pciDir)
+	mustMkdir(t, filepath.Join(root, "class", "hailo_chardev", "hailo1"))
+	if err := os.Symlink(pciDir, filepath.Join(root, "class", "hailo_chardev", "hailo1", "device")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewHailortcliDiscoverer("hailortcli", root)
+	d.Run = fixtureRunner(t, "scan.txt")
+
+	devices, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d", len(devices))
+	}
+
+	first := devices[0]
+	if first.Name != "hailo0" || first.PCIAddress != "0000:01:00.0" {
+		t.Errorf("Unexpected first device: %+v", first)
+	}
+	if first.FirmwareVersion != "4.23.0" {
+		t.Errorf("Expected firmware 4.23.0, got %q", first.FirmwareVersion)
+	}
+	if first.Architecture != "HAILO8" || first.SerialNumber != "HLLWM2B225100293" {
+		t.Errorf("Unexpected identify data: %+v", first)
+	}
+	if devices[1].Name != "hailo1" || devices[1].Architecture != "HAILO8L" {
+		t.Errorf("Expected hailo1 with HAILO8L for second device, got %+v", devices[1])
+	}
+}
+
+func TestHailortcliDiscoverer_SkipsDevicesWithoutChardev(t *testing.T) {
+	root := t.TempDir()
+	// Only the second device is known to sysfs, it must not become hailo0
+	mustMkdir(t, filepath.Join(root, "bus", "pci", "devices", "0000:02:00.0", "hailo_chardev", "hailo1"))
+
+	d := NewHailortcliDiscoverer("hailortcli", root)
+	d.Run = fixtureRunner(t, "scan.txt")
+
+	devices, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "hailo1" || devices[0].PCIAddress != "0000:02:00.0" {
+		t.Errorf("Expected only hailo1 at 0000:02:00.0, got %+v", devices)
+	}
+}
+
+func TestHailortcliDiscoverer_UsesSysfsNames(t *testing.T) {
+	root := t.TempDir()
+	mustMkdir(t, filepath.Join(root, "bus", "pci", "devices", "0000:01:00.0", "hailo_chardev", "hailo3"))
+
+	d := NewHailortcliDiscoverer("hailortcli", root)
+	d.Run = fixtureRunner(t, "scan-legacy.txt")
+
+	devices, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "hailo3" || devices[0].Index != 3 {
+		t.Errorf("Expected hailo3 from sysfs, got %+v", devices)
+	}
+}
+
+func TestHailortcliDiscoverer_ScanFailure(t *testing.T) {
+	d := NewHailortcliDiscoverer("hailortcli", t.TempDir())
+	d.Run = func(string, ...string) ([]byte, error) {
+		return nil, errors.New("executable file not found")
+	}
+
+	if _, err := d.Discover(); err == nil {
+		t.Error("Expected error when hailortcli cannot run")
+	}
+}
@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// DefaultProbeTimeout bounds a single run of the health probe command
+const DefaultProbeTimeout = 5 * time.Second
+
+// aerCounterFiles are the per-function AER statistics exported by the kernel.
+// Only uncorrectable errors make a device unhealthy, correctable ones are logged.
+var aerCounterFiles = map[string]string{
+	"aer_dev_nonfatal": "TOTAL_ERR_NONFATAL",
+	"aer_dev_fatal":    "TOTAL_ERR_FATAL",
+}
+
+// HealthChecker decides whether a device is usable. A device is unhealthy
+// when its node or sysfs entry is gone, its driver is unbound, its PCIe AER
+// uncorrectable error counters increased, or the optional probe fails.
+// Devices without sysfs data only get the node and probe checks.
+type HealthChecker struct {
+	SysfsRoot string
+	DevRoot   string
+	// Probe is an optional command run per device. The placeholders {name},
+	// {dev} and {pci} in its arguments are replaced with the device's values.
+	Probe        []string
+	ProbeTimeout time.Duration
+
+	// aerTotals remembers the last uncorrectable error count per device
+	aerTotals map[string]uint64
+}
+
+// NewHealthChecker creates a checker for the given sysfs and /dev roots
+func NewHealthChecker(sysfsRoot, devRoot string) *HealthChecker {
+	return &HealthChecker{
+		SysfsRoot:    sysfsRoot,
+		DevRoot:      devRoot,
+		ProbeTimeout: DefaultProbeTimeout,
+		aerTotals:    make(map[string]uint64),
+	}
+}
+
+// Check returns nil for a healthy device, or an error naming the failed check
+func (h *HealthChecker) Check(dev device.Device) error {
+	if _, err := os.Stat(filepath.Join(h.DevRoot, dev.Name)); err != nil {
+		return fmt.Errorf("device node missing: %w", err)
+	}
+
+	// Static devices are not described by sysfs, only their node is checked
+	if !dev.NoSysfs {
+		if _, err := os.Stat(filepath.Join(h.SysfsRoot, hailoClassDir, dev.Name)); err != nil {
+			return fmt.Errorf("sysfs entry vanished: %w", err)
+		}
+	}
+
+	// Backends without a PCI address cannot be checked any further in sysfs
+	if dev.PCIAddress != "" && !dev.NoSysfs {
+		pciDir := filepath.Join(h.SysfsRoot, "bus", "pci", "devices", dev.PCIAddress)
+
+		if _, err := os.Readlink(filepath.Join(pciDir, "driver")); err != nil {
+			return fmt.Errorf("driver unbound from %s", dev.PCIAddress)
+		}
+
+		if err := h.checkAER(dev.Name, pciDir); err != nil {
+			return err
+		}
+	}
+
+	if len(h.Probe) > 0 {
+		if err := h.runProbe(dev); err != nil {
+			return fmt.Errorf("health probe failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Forget drops the AER baseline of a device that left the inventory
+func (h *HealthChecker) Forget(name string) {
+	delete(h.aerTotals, name)
+}
+
+// checkAER fails when the uncorrectable error count grew since the last check.
+// The first reading only establishes the baseline.
+func (h *HealthChecker) checkAER(name, pciDir string) error {
+	var total uint64
+	found := false
+	for file, key := range aerCounterFiles {
+		count, err := readAERCounter(filepath.Join(pciDir, file), key)
+		if err != nil {
+			// Kernels without AER support simply lack these files
+			continue
+		}
+		total += count
+		found = true
+	}
+
+	if corr, err := readAERCounter(filepath.Join(pciDir, "aer_dev_correctable"), "TOTAL_ERR_COR"); err == nil && corr > 0 {
+		log.Printf("Device %s has %d correctable PCIe errors", name, corr)
+	}
+
+	if !found {
+		return nil
+	}
+
+	previous, seen := h.aerTotals[name]
+	h.aerTotals[name] = total
+	if seen && total > previous {
+		return fmt.Errorf("PCIe AER uncorrectable errors increased from %d to %d", previous, total)
+	}
+	return nil
+}
+
+// readAERCounter returns the value of key in an AER statistics file,
+// whose lines look like "TOTAL_ERR_FATAL 0"
+func readAERCounter(path, key string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s not found in %s", key, path)
+}
+
+// runProbe executes the configured probe for one device
+func (h *HealthChecker) runProbe(dev device.Device) error {
+	replacer := strings.NewReplacer("{name}", dev.Name, "{dev}", dev.DevPath, "{pci}", dev.PCIAddress)
+	args := make([]string, 0, len(h.Probe))
+	for _, arg := range h.Probe {
+		args = append(args, replacer.Replace(arg))
+	}
+
+	timeout := h.ProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// newHealthFixture returns a checker over a fake sysfs with one bound device
+// and a /dev root containing its node
+func newHealthFixture(t *testing.T) (*HealthChecker, device.Device, string) {
+	t.Helper()
+	sysfsRoot := newFakeSysfs(t, fakePCIDevice{name: "hailo0", bdf: "0000:01:00.0", driver: "hailo"})
+	devRoot := t.TempDir()
+	mustWrite(t, filepath.Join(devRoot, "hailo0"), "")
+
+	dev := device.New("hailo0")
+	dev.PCIAddress = "0000:01:00.0"
+	return NewHealthChecker(sysfsRoot, devRoot), dev, sysfsRoot
+}
+
+func writeAER(t *testing.T, sysfsRoot, file, key string, count int) {
+	t.Helper()
+	content := "Undefined 0\n" + key + " " + strconv.Itoa(count) + "\n"
+	mustWrite(t, filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0", file), content)
+}
+
+func TestHealthChecker_Healthy(t *testing.T) {
+	h, dev, _ := newHealthFixture(t)
+	if err := h.Check(dev); err != nil {
+		t.Errorf("Expected healthy device, got %v", err)
+	}
+}
+
+func TestHealthChecker_DeviceNodeMissing(t *testing.T) {
+	h, dev, _ := newHealthFixture(t)
+	os.Remove(filepath.Join(h.DevRoot, "hailo0"))
+
+	if err := h.Check(dev); err == nil || !strings.Contains(err.Error(), "device node missing") {
+		t.Errorf("Expected device node error, got %v", err)
+	}
+}
+
+func TestHealthChecker_SysfsEntryVanished(t *testing.T) {
+	h, dev, sysfsRoot := newHealthFixture(t)
+	os.Remove(filepath.Join(sysfsRoot, hailoClassDir, "hailo0"))
+
+	if err := h.Check(dev); err == nil || !strings.Contains(err.Error(), "sysfs entry vanished") {
+		t.Errorf("Expected sysfs error, got %v", err)
+	}
+}
+
+func TestHealthChecker_StaticDevices(t *testing.T) {
+	devices, err := NewStaticDiscoverer(filepath.Join("testdata", "static", "devices.json")).Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	// The node has no sysfs: no class entries and no PCI functions
+	devRoot := t.TempDir()
+	for _, dev := range devices {
+		mustWrite(t, filepath.Join(devRoot, dev.Name), "")
+	}
+	h := NewHealthChecker(t.TempDir(), devRoot)
+
+	for _, dev := range devices {
+		if err := h.Check(dev); err != nil {
+			t.Errorf("Expected static device %s to be healthy, got %v", dev.Name, err)
+		}
+	}
+
+	os.Remove(filepath.Join(devRoot, devices[0].Name))
+	if err := h.Check(devices[0]); err == nil || !strings.Contains(err.Error(), "device node missing") {
+		t.Errorf("Expected the device node to be checked, got %v", err)
+	}
+}
+
+func TestHealthChecker_DriverUnbound(t *testing.T) {
+	h, dev, sysfsRoot := newHealthFixture(t)
+	os.Remove(filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0", "driver"))
+
+	if err := h.Check(dev); err == nil || !strings.Contains(err.Error(), "driver unbound") {
+		t.Errorf("Expected driver error, got %v", err)
+	}
+}
+
+func TestHealthChecker_AERIncrease(t *testing.T) {
+	h, dev, sysfsRoot := newHealthFixture(t)
+	writeAER(t, sysfsRoot, "aer_dev_nonfatal", "TOTAL_ERR_NONFATAL", 2)
+	writeAER(t, sysfsRoot, "aer_dev_fatal", "TOTAL_ERR_FATAL", 0)
+
+	// Existing errors only set the baseline
+	if err := h.Check(dev); err != nil {
+		t.Fatalf("First check should be healthy, got %v", err)
+	}
+
+	writeAER(t, sysfsRoot, "aer_dev_fatal", "TOTAL_ERR_FATAL", 1)
+	if err := h.Check(dev); err == nil || !strings.Contains(err.Error(), "AER") {
+		t.Errorf("Expected AER error, got %v", err)
+	}
+
+	// No further increase means healthy again
+	if err := h.Check(dev); err != nil {
+		t.Errorf("Expected healthy after counters settle, got %v", err)
+	}
+}
+
+func TestHealthChecker_Probe(t *testing.T) {
+	h, dev, _ := newHealthFixture(t)
+
+	h.Probe = []string{"sh", "-c", "test {name} = hailo0"}
+	if err := h.Check(dev); err != nil {
+		t.Errorf("Expected passing probe, got %v", err)
+	}
+
+	h.Probe = []string{"sh", "-c", "echo firmware not responding; exit 1"}
+	err := h.Check(dev)
+	if err == nil || !strings.Contains(err.Error(), "firmware not responding") {
+		t.Errorf("Expected probe failure with output, got %v", err)
+	}
+}
+
+func TestResourceMonitor_VanishedDeviceUnhealthy(t *testing.T) {
+	h, dev, sysfsRoot := newHealthFixture(t)
+	writeAER(t, sysfsRoot, "aer_dev_fatal", "TOTAL_ERR_FATAL", 0)
+	discoverer := &fakeDiscoverer{name: "fake", devices: []device.Device{dev}}
+	tracker := NewHealthTracker(2, 1)
+
+	m := NewResourceMonitor(&Config{CdiDir: t.TempDir(), Discoverer: discoverer, Health: h, Tracker: tracker})
+	m.refresh("test")
+
+	snap, _ := m.Latest()
+	if state, ok := snap.Lookup("hailo0"); !ok || !state.Healthy {
+		t.Fatalf("Expected healthy hailo0, got %+v", snap.Devices)
+	}
+
+	// Simulate a hot-remove: discovery and sysfs lose the device
+	discoverer.devices = []device.Device{}
+	os.Remove(filepath.Join(sysfsRoot, hailoClassDir, "hailo0"))
+	m.refresh("test")
+
+	// The spec no longer has it, so it is unhealthy at once but kept
+	// through the damping window
+	snap, _ = m.Latest()
+	state, ok := snap.Lookup("hailo0")
+	if !ok || state.Healthy || state.Reason == "" {
+		t.Fatalf("Expected hailo0 to be reported unhealthy with a reason, got %+v", snap.Devices)
+	}
+
+	m.publish()
+	snap, _ = m.Latest()
+	if _, ok := snap.Lookup("hailo0"); !ok {
+		t.Fatal("Vanished device should be kept until the damping window passed")
+	}
+
+	// Once kubelet was told, the device and its health state are dropped
+	m.publish()
+	snap, _ = m.Latest()
+	if _, ok := snap.Lookup("hailo0"); ok {
+		t.Errorf("Expected hailo0 to be removed, got %+v", snap.Devices)
+	}
+	if len(tracker.Status()) != 0 {
+		t.Errorf("Expected the tracker to forget hailo0, got %+v", tracker.Status())
+	}
+	if _, ok := h.aerTotals["hailo0"]; ok {
+		t.Error("Expected the AER baseline of hailo0 to be forgotten")
+	}
+
+	// A device that comes back starts over
+	discoverer.devices = []device.Device{dev}
+	m.refresh("test")
+	if snap, _ = m.Latest(); len(snap.Devices) != 1 {
+		t.Errorf("Expected hailo0 to be rediscovered, got %+v", snap.Devices)
+	}
+}
+
+func TestResourceMonitor_VanishedDeviceWithPassingChecks(t *testing.T) {
+	// Discovery drops the device (e.g. a missed hailortcli scan) while its
+	// node and sysfs entry stay, so every health check keeps passing
+	h, dev, _ := newHealthFixture(t)
+	discoverer := &fakeDiscoverer{name: "fake", devices: []device.Device{dev}}
+
+	m := NewResourceMonitor(&Config{CdiDir: t.TempDir(), Discoverer: discoverer, Health: h})
+	m.refresh("test")
+	if err := h.Check(dev); err != nil {
+		t.Fatalf("Expected the checker to pass: %v", err)
+	}
+
+	discoverer.devices = []device.Device{}
+	m.refresh("test")
+	snap, _ := m.Latest()
+	state, ok := snap.Lookup("hailo0")
+	if !ok || state.Healthy || state.Reason != errNotDiscovered.Error() {
+		t.Fatalf("Expected hailo0 to be unhealthy as no longer discovered, got %+v", snap.Devices)
+	}
+
+	m.publish()
+	if snap, _ = m.Latest(); len(snap.Devices) != 0 {
+		t.Errorf("Expected hailo0 to be removed, got %+v", snap.Devices)
+	}
+}
@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failed checks before a device turns unhealthy
+	DefaultFailureThreshold = 3
+	// DefaultSuccessThreshold is the number of consecutive passed checks before a device recovers
+	DefaultSuccessThreshold = 3
+	// healthHistorySize caps the transitions kept per device
+	healthHistorySize = 20
+)
+
+// HealthTransition records one change of a device's reported health
+type HealthTransition struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+	Reason  string    `json:"reason"`
+}
+
+// DeviceHealthStatus is the damped health of one device and how it got there
+type DeviceHealthStatus struct {
+	Name                 string             `json:"name"`
+	Healthy              bool               `json:"healthy"`
+	Reason               string             `json:"reason,omitempty"`
+	ConsecutiveFailures  int                `json:"consecutiveFailures"`
+	ConsecutiveSuccesses int                `json:"consecutiveSuccesses"`
+	History              []HealthTransition `json:"history"`
+}
+
+// HealthTracker damps health flaps: a device needs FailureThreshold
+// consecutive failed checks to become unhealthy and SuccessThreshold
+// consecutive passed checks to recover
+type HealthTracker struct {
+	FailureThreshold int
+	SuccessThreshold int
+
+	mu      sync.Mutex
+	devices map[string]*DeviceHealthStatus
+	now     func() time.Time
+	// changes counts transitions, reason updates and forgotten devices,
+	// changed is the time of the last one
+	changes uint64
+	changed time.Time
+	// written is the value of changes in the status file, -1 before the first write
+	written int64
+}
+
+// NewHealthTracker creates a tracker with the given thresholds,
+// values below one disable damping for that direction
+func NewHealthTracker(failureThreshold, successThreshold int) *HealthTracker {
+	return &HealthTracker{
+		FailureThreshold: failureThreshold,
+		SuccessThreshold: successThreshold,
+		devices:          make(map[string]*DeviceHealthStatus),
+		now:              time.Now,
+		written:          -1,
+	}
+}
+
+// Observe records the result of one health check and returns the damped
+// health. The first observation of a device is taken as is, so a broken
+// device is never advertised healthy while its failures accumulate.
+func (t *HealthTracker) Observe(name string, checkErr error) (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.devices[name]
+	if !ok {
+		status = &DeviceHealthStatus{Name: name, Healthy: checkErr == nil}
+		t.devices[name] = status
+		reason := "initial check passed"
+		if checkErr != nil {
+			status.Reason = checkErr.Error()
+			reason = "initial check failed: " + checkErr.Error()
+		}
+		t.record(status, reason)
+	}
+
+	if checkErr != nil {
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		if status.Healthy {
+			if status.ConsecutiveFailures >= max(t.FailureThreshold, 1) {
+				status.Healthy = false
+				status.Reason = checkErr.Error()
+				t.record(status, fmt.Sprintf("%d consecutive failed checks: %v", status.ConsecutiveFailures, checkErr))
+			} else {
+				log.Printf("Device %s check failed (%d/%d), keeping it healthy: %v",
+					name, status.ConsecutiveFailures, t.FailureThreshold, checkErr)
+			}
+		} else if status.Reason != checkErr.Error() {
+			// Keep the reported reason current while the device stays down
+			status.Reason = checkErr.Error()
+			t.changed, t.changes = t.now(), t.changes+1
+		}
+	} else {
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		if !status.Healthy {
+			if status.ConsecutiveSuccesses >= max(t.SuccessThreshold, 1) {
+				status.Healthy = true
+				status.Reason = ""
+				t.record(status, fmt.Sprintf("recovered after %d consecutive passed checks", status.ConsecutiveSuccesses))
+			} else {
+				log.Printf("Device %s check passed (%d/%d), keeping it unhealthy",
+					name, status.ConsecutiveSuccesses, t.SuccessThreshold)
+			}
+		}
+	}
+
+	return status.Healthy, status.Reason
+}
+
+// Forget drops the state and history of a device that left the inventory
+func (t *HealthTracker) Forget(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.devices[name]; ok {
+		delete(t.devices, name)
+		t.changed, t.changes = t.now(), t.changes+1
+	}
+}
+
+// Status returns a copy of the tracked health of every device, sorted by name
+func (t *HealthTracker) Status() []DeviceHealthStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]DeviceHealthStatus, 0, len(t.devices))
+	for _, s := range t.devices {
+		c := *s
+		c.History = append([]HealthTransition(nil), s.History...)
+		statuses = append(statuses, c)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// record appends a transition, dropping the oldest beyond the history size
+func (t *HealthTracker) record(status *DeviceHealthStatus, reason string) {
+	log.Printf("Device %s health transition: healthy=%v (%s)", status.Name, status.Healthy, reason)
+
+	t.changed, t.changes = t.now(), t.changes+1
+	status.History = append(status.History, HealthTransition{
+		Time:    t.changed,
+		Healthy: status.Healthy,
+		Reason:  reason,
+	})
+	if len(status.History) > healthHistorySize {
+		status.History = status.History[len(status.History)-healthHistorySize:]
+	}
+}
+
+// healthStatusFile is the on-disk format of the status file
+type healthStatusFile struct {
+	// Updated is the time of the last health change
+	Updated time.Time            `json:"updated"`
+	Devices []DeviceHealthStatus `json:"devices"`
+}
+
+// WriteStatusFile atomically writes the tracked health to path as JSON.
+// It does nothing when no device changed since the last successful write,
+// so the check counters in the file are those of the last change.
+func (t *HealthTracker) WriteStatusFile(path string) error {
+	t.mu.Lock()
+	changes, changed, unchanged := t.changes, t.changed, int64(t.changes) == t.written
+	t.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(healthStatusFile{
+		Updated: changed,
+		Devices: t.Status(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create status directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.written = int64(changes)
+	t.mu.Unlock()
+	return nil
+}
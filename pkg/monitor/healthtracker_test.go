@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealthTracker_Hysteresis(t *testing.T) {
+	tracker := NewHealthTracker(3, 2)
+	glitch := errors.New("device node missing")
+
+	steps := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, true},    // initial check
+		{glitch, true}, // 1/3 failures
+		{glitch, true}, // 2/3 failures
+		{nil, true},    // streak reset
+		{glitch, true}, // 1/3
+		{glitch, true}, // 2/3
+		{glitch, false},
+		{nil, false}, // 1/2 successes
+		{glitch, false},
+		{nil, false},
+		{nil, true},
+	}
+
+	for i, step := range steps {
+		healthy, reason := tracker.Observe("hailo0", step.err)
+		if healthy != step.expected {
+			t.Fatalf("Step %d: expected healthy=%v, got %v (%s)", i, step.expected, healthy, reason)
+		}
+		if !healthy && reason == "" {
+			t.Errorf("Step %d: unhealthy device must carry a reason", i)
+		}
+	}
+
+	status := tracker.Status()
+	if len(status) != 1 {
+		t.Fatalf("Expected one device status, got %d", len(status))
+	}
+	// initial, unhealthy, recovered
+	if len(status[0].History) != 3 {
+		t.Errorf("Expected 3 transitions, got %+v", status[0].History)
+	}
+	if status[0].History[1].Healthy || status[0].History[2].Reason == "" {
+		t.Errorf("Unexpected transition history: %+v", status[0].History)
+	}
+}
+
+func TestHealthTracker_InitialFailureIsImmediate(t *testing.T) {
+	tracker := NewHealthTracker(3, 3)
+	if healthy, _ := tracker.Observe("hailo0", errors.New("driver unbound")); healthy {
+		t.Error("A device failing its first check should not be advertised healthy")
+	}
+}
+
+func TestHealthTracker_WriteStatusFile(t *testing.T) {
+	tracker := NewHealthTracker(1, 1)
+	tracker.Observe("hailo0", nil)
+	tracker.Observe("hailo1", errors.New("sysfs entry vanished"))
+
+	path := filepath.Join(t.TempDir(), "state", "health.json")
+	if err := tracker.WriteStatusFile(path); err != nil {
+		t.Fatalf("WriteStatusFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read status file: %v", err)
+	}
+	var status healthStatusFile
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatalf("Status file is not valid JSON: %v", err)
+	}
+	if len(status.Devices) != 2 || status.Devices[1].Healthy || status.Devices[1].Reason != "sysfs entry vanished" {
+		t.Errorf("Unexpected status contents: %+v", status.Devices)
+	}
+}
+
+func TestHealthTracker_WriteStatusFileOnlyOnChange(t *testing.T) {
+	tracker := NewHealthTracker(2, 1)
+	tracker.Observe("hailo0", nil)
+
+	path := filepath.Join(t.TempDir(), "health.json")
+	write := func() bool {
+		t.Helper()
+		os.Remove(path)
+		if err := tracker.WriteStatusFile(path); err != nil {
+			t.Fatalf("WriteStatusFile failed: %v", err)
+		}
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	if !write() {
+		t.Fatal("Expected the first write to create the file")
+	}
+	// Passed checks and a failure within the damping window change no state
+	tracker.Observe("hailo0", nil)
+	tracker.Observe("hailo0", errors.New("device node missing"))
+	if write() {
+		t.Error("Expected no write without a health change")
+	}
+
+	tracker.Observe("hailo0", errors.New("device node missing"))
+	if !write() {
+		t.Error("Expected a write after the device turned unhealthy")
+	}
+	tracker.Observe("hailo0", errors.New("driver unbound"))
+	if !write() {
+		t.Error("Expected a write after the reason changed")
+	}
+	tracker.Forget("hailo0")
+	if !write() {
+		t.Error("Expected a write after the device was forgotten")
+	}
+}
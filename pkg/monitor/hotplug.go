@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDevRoot is where the hailo_pci driver creates device nodes
+const DefaultDevRoot = "/dev"
+
+// HotplugEvent describes a device change noticed by the HotplugWatcher
+type HotplugEvent struct {
+	// Source is "uevent" or "fsnotify"
+	Source string
+	// Action is the kernel action (add, remove, bind, unbind, ...) or fsnotify op
+	Action string
+	// Path is the sysfs devpath or file that changed
+	Path string
+}
+
+// HotplugWatcher reports Hailo device arrival and removal as it happens.
+// It listens to kernel uevents and falls back to fsnotify on /dev and
+// /sys/class/hailo_chardev when the netlink socket cannot be opened.
+type HotplugWatcher struct {
+	sysfsRoot string
+	devRoot   string
+	eventChan chan HotplugEvent
+	uevents   *UeventSocket
+	fsWatcher *fsnotify.Watcher
+}
+
+// NewHotplugWatcher creates a watcher for the given sysfs and /dev roots
+func NewHotplugWatcher(sysfsRoot, devRoot string) *HotplugWatcher {
+	return &HotplugWatcher{
+		sysfsRoot: sysfsRoot,
+		devRoot:   devRoot,
+		eventChan: make(chan HotplugEvent, 16),
+	}
+}
+
+// Start subscribes to uevents, or to fsnotify if uevents are unavailable
+func (w *HotplugWatcher) Start(ctx context.Context) error {
+	err := w.startUevents(ctx)
+	if err == nil {
+		log.Println("Hotplug detection using kernel uevents")
+		return nil
+	}
+	log.Printf("Kernel uevents unavailable, falling back to fsnotify: %v", err)
+
+	if err := w.startFsnotify(ctx); err != nil {
+		return fmt.Errorf("failed to start hotplug detection: %w", err)
+	}
+	log.Println("Hotplug detection using fsnotify")
+	return nil
+}
+
+// Events returns the channel of device changes
+func (w *HotplugWatcher) Events() <-chan HotplugEvent {
+	return w.eventChan
+}
+
+// Close stops the underlying uevent socket or fsnotify watcher
+func (w *HotplugWatcher) Close() error {
+	var errs []error
+	if w.uevents != nil {
+		errs = append(errs, w.uevents.Close())
+	}
+	if w.fsWatcher != nil {
+		errs = append(errs, w.fsWatcher.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// startUevents opens the netlink socket and forwards Hailo events
+func (w *HotplugWatcher) startUevents(ctx context.Context) error {
+	sock, err := OpenUeventSocket()
+	if err != nil {
+		return err
+	}
+	w.uevents = sock
+
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	go func() {
+		for {
+			msg, err := sock.Read()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Uevent socket read failed: %v", err)
+				}
+				return
+			}
+
+			ev, err := ParseUevent(msg)
+			if err != nil || !ev.IsHailoEvent() {
+				continue
+			}
+			log.Printf("Uevent: %s %s (subsystem %s)", ev.Action, ev.DevPath, ev.Subsystem)
+			w.emit(HotplugEvent{Source: "uevent", Action: ev.Action, Path: ev.DevPath})
+		}
+	}()
+
+	return nil
+}
+
+// startFsnotify watches /dev for hailoN nodes and the sysfs class directory
+func (w *HotplugWatcher) startFsnotify(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create fsnotify watcher: %w", err)
+	}
+	w.fsWatcher = watcher
+
+	if err := watcher.Add(w.devRoot); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", w.devRoot, err)
+	}
+
+	// The class directory only exists while the driver is loaded,
+	// watch its parent to notice the driver coming and going
+	classDir := filepath.Join(w.sysfsRoot, hailoClassDir)
+	for _, dir := range []string{classDir, filepath.Dir(classDir)} {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Warning: failed to watch %s: %v", dir, err)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !w.isHailoPath(event.Name) {
+					continue
+				}
+				log.Printf("Hotplug fsnotify event: %s (op: %v)", event.Name, event.Op)
+				w.emit(HotplugEvent{Source: "fsnotify", Action: event.Op.String(), Path: event.Name})
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Hotplug watcher error: %v", err)
+
+			case <-ctx.Done():
+				watcher.Close()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// isHailoPath filters fsnotify events down to hailoN nodes and the
+// hailo_chardev class directory
+func (w *HotplugWatcher) isHailoPath(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), "hailo")
+}
+
+// emit forwards an event without blocking; a full channel already
+// guarantees a pending rescan, so dropping the event loses nothing
+func (w *HotplugWatcher) emit(ev HotplugEvent) {
+	select {
+	case w.eventChan <- ev:
+	default:
+	}
+}
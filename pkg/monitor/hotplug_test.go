@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHotplugWatcher_FsnotifyDeviceNode(t *testing.T) {
+	devRoot := t.TempDir()
+	sysfsRoot := newFakeSysfs(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := NewHotplugWatcher(sysfsRoot, devRoot)
+	if err := w.startFsnotify(ctx); err != nil {
+		t.Fatalf("Failed to start fsnotify watcher: %v", err)
+	}
+	defer w.Close()
+
+	// Unrelated nodes must not trigger a rescan
+	mustWrite(t, filepath.Join(devRoot, "ttyS0"), "")
+	mustWrite(t, filepath.Join(devRoot, "hailo0"), "")
+
+	select {
+	case ev := <-w.Events():
+		if ev.Source != "fsnotify" || filepath.Base(ev.Path) != "hailo0" {
+			t.Errorf("Unexpected event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for device node event")
+	}
+
+	if err := os.Remove(filepath.Join(devRoot, "hailo0")); err != nil {
+		t.Fatalf("Failed to remove node: %v", err)
+	}
+
+	select {
+	case ev := <-w.Events():
+		if filepath.Base(ev.Path) != "hailo0" {
+			t.Errorf("Unexpected event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for device removal event")
+	}
+}
+
+func TestHotplugWatcher_FsnotifyMissingDevRoot(t *testing.T) {
+	w := NewHotplugWatcher(t.TempDir(), filepath.Join(t.TempDir(), "missing"))
+	if err := w.startFsnotify(context.Background()); err == nil {
+		w.Close()
+		t.Error("Expected error when /dev root does not exist")
+	}
+}
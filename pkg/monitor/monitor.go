@@ -2,64 +2,399 @@ package monitor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os/exec"
+	"sort"
 	"strings"
 	"time"
 
 	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
 )
 
-// ResourceMonitor monitors Hailo devices and updates CDI
+const (
+	// DefaultResyncInterval is the safety-net rescan period when no hotplug event arrives
+	DefaultResyncInterval = 60 * time.Second
+	// DefaultHotplugSettle coalesces the burst of uevents a single PCIe change produces
+	DefaultHotplugSettle = 250 * time.Millisecond
+	// DefaultHealthInterval is how often known devices are re-checked between rescans
+	DefaultHealthInterval = 10 * time.Second
+)
+
+// errNotDiscovered fails the health checks of a device missing from discovery
+var errNotDiscovered = errors.New("device is no longer discovered")
+
+// ResourceMonitor monitors Hailo devices, updates CDI and publishes
+// device set changes to its subscribers
 type ResourceMonitor struct {
-	cdiDir string
+	cdiDir      string
+	specDirs    []string
+	sysfsRoot   string
+	generator   *cdi.Generator
+	discoverer  Discoverer
+	health      *HealthChecker
+	tracker     *HealthTracker
+	statusFile  string
+	intervals   Intervals
+	hotplug     *HotplugWatcher
+	broadcaster *Broadcaster
+
+	// known holds the inventory. A device that disappears is reported
+	// unhealthy at once and only dropped after the damping window.
+	known map[string]device.Device
+	// vanished holds the known devices missing from the last discovery,
+	// true once their damped state is unhealthy
+	vanished map[string]bool
+	// specReport is the last logged result of checkSpecs
+	specReport string
+}
+
+// Config holds configuration for the resource monitor
+type Config struct {
+	CdiDir string
+	// SpecDirs are the CDI spec directories in increasing priority, checked
+	// for specs conflicting with the generated one. CdiDir is added if missing.
+	SpecDirs []string
+	// SysfsRoot and DevRoot default to /sys and /dev
+	SysfsRoot  string
+	DevRoot    string
+	Discoverer Discoverer
+	// Health checks devices, nil reports every known device as healthy
+	Health *HealthChecker
+	// Tracker damps health flaps, nil applies every check result directly
+	Tracker *HealthTracker
+	// StatusFile receives the per-device health history as JSON, optional
+	StatusFile string
+	// Generator renders the CDI spec, nil uses the defaults with SysfsRoot and DevRoot
+	Generator *cdi.Generator
+	// Intervals of the monitor loop, zero values use the defaults
+	Intervals Intervals
+}
+
+// Intervals controls how often the monitor rescans and re-checks devices
+type Intervals struct {
+	// Resync is the rescan period when no hotplug event arrives
+	Resync time.Duration
+	// HotplugSettle is how long hotplug events are coalesced before a rescan
+	HotplugSettle time.Duration
+	// Health is how often known devices are re-checked between rescans
+	Health time.Duration
+}
+
+// withDefaults fills in the default of every unset interval
+func (i Intervals) withDefaults() Intervals {
+	if i.Resync <= 0 {
+		i.Resync = DefaultResyncInterval
+	}
+	if i.HotplugSettle <= 0 {
+		i.HotplugSettle = DefaultHotplugSettle
+	}
+	if i.Health <= 0 {
+		i.Health = DefaultHealthInterval
+	}
+	return i
 }
 
 // NewResourceMonitor creates a new monitor
-func NewResourceMonitor(cdiDir string) *ResourceMonitor {
-	return &ResourceMonitor{cdiDir: cdiDir}
+func NewResourceMonitor(config *Config) *ResourceMonitor {
+	sysfsRoot := config.SysfsRoot
+	if sysfsRoot == "" {
+		sysfsRoot = DefaultSysfsRoot
+	}
+	devRoot := config.DevRoot
+	if devRoot == "" {
+		devRoot = DefaultDevRoot
+	}
+
+	generator := config.Generator
+	if generator == nil {
+		generator = cdi.NewGenerator(devRoot, sysfsRoot)
+	}
+
+	specDirs := config.SpecDirs
+	if len(specDirs) > 0 && !contains(specDirs, config.CdiDir) {
+		specDirs = append([]string{config.CdiDir}, specDirs...)
+	}
+
+	return &ResourceMonitor{
+		cdiDir:      config.CdiDir,
+		specDirs:    specDirs,
+		sysfsRoot:   sysfsRoot,
+		generator:   generator,
+		discoverer:  config.Discoverer,
+		health:      config.Health,
+		tracker:     config.Tracker,
+		statusFile:  config.StatusFile,
+		intervals:   config.Intervals.withDefaults(),
+		hotplug:     NewHotplugWatcher(sysfsRoot, devRoot),
+		broadcaster: NewBroadcaster(),
+		known:       make(map[string]device.Device),
+		vanished:    make(map[string]bool),
+	}
 }
 
-// Start begins monitoring devices with context support
+// Start begins monitoring devices with context support.
+// The CDI spec is regenerated as soon as a hotplug event settles,
+// with a periodic resync in case an event was missed.
 func (m *ResourceMonitor) Start(ctx context.Context) {
+	if err := m.hotplug.Start(ctx); err != nil {
+		log.Printf("Hotplug detection disabled, relying on periodic rescans: %v", err)
+	}
+
 	go func() {
 		// Generate CDI immediately on startup
-		devices := m.discoverDevices()
-		log.Printf("Initial device discovery: %v", devices)
-		if err := cdi.GenerateCDI(devices, m.cdiDir); err != nil {
-			log.Printf("Failed to generate initial CDI: %v", err)
-		} else {
-			log.Println("Initial CDI generated")
-		}
+		m.refresh("initial discovery")
 
-		ticker := time.NewTicker(60 * time.Second) // Check every 60 seconds
+		ticker := time.NewTicker(m.intervals.Resync)
 		defer ticker.Stop()
 
+		healthTicker := time.NewTicker(m.intervals.Health)
+		defer healthTicker.Stop()
+
+		var settle <-chan time.Time
 		for {
 			select {
-			case <-ticker.C:
-				devices := m.discoverDevices()
-				log.Printf("Discovered devices: %v", devices)
-				if err := cdi.GenerateCDI(devices, m.cdiDir); err != nil {
-					log.Printf("Failed to generate CDI: %v", err)
-				} else {
-					log.Println("CDI updated")
+			case ev := <-m.hotplug.Events():
+				log.Printf("Hotplug event from %s: %s %s", ev.Source, ev.Action, ev.Path)
+				if settle == nil {
+					settle = time.After(m.intervals.HotplugSettle)
 				}
+			case <-settle:
+				settle = nil
+				m.refresh("hotplug")
+			case <-ticker.C:
+				m.refresh("periodic resync")
+				m.logHealthStatus()
+			case <-healthTicker.C:
+				m.publish()
 			case <-ctx.Done():
 				log.Println("Monitor stopping due to context cancellation")
+				m.hotplug.Close()
 				return
 			}
 		}
 	}()
 }
 
-// discoverDevices simulates device discovery (replace with actual Hailo API)
-func (m *ResourceMonitor) discoverDevices() []string {
-	// Placeholder: Return list of device paths
-	output, err := exec.Command("ls", "/sys/class/hailo_chardev").Output()
+// Subscribe returns a channel receiving the current device snapshot and
+// every later change. The returned function must be called to unsubscribe.
+func (m *ResourceMonitor) Subscribe() (<-chan Snapshot, func()) {
+	return m.broadcaster.Subscribe()
+}
+
+// Latest returns the most recent device snapshot
+func (m *ResourceMonitor) Latest() (Snapshot, bool) {
+	return m.broadcaster.Latest()
+}
+
+// refresh rediscovers devices, regenerates the CDI spec and publishes the new set
+func (m *ResourceMonitor) refresh(reason string) {
+	devices, err := m.discoverDevices()
+	if err != nil {
+		// An empty spec would break containers being created right now,
+		// so the last good inventory and spec stay in place
+		log.Printf("Failed to discover devices (%s), keeping the last inventory: %v", reason, err)
+		return
+	}
+	log.Printf("Discovered devices (%s): %v", reason, device.Names(devices))
+	written, err := m.generator.Generate(devices, m.cdiDir)
+	if err != nil {
+		// Kubelet must not be offered devices the runtime cannot resolve
+		log.Printf("Failed to generate CDI: %v", err)
+		return
+	}
+	if written {
+		log.Println("CDI updated")
+	}
+	m.checkSpecs()
+
+	present := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		m.known[d.Name] = d
+		present[d.Name] = true
+		delete(m.vanished, d.Name)
+	}
+	for name := range m.known {
+		if _, ok := m.vanished[name]; !ok && !present[name] {
+			log.Printf("Device %s is no longer discovered", name)
+			m.vanished[name] = false
+		}
+	}
+
+	m.publish()
+}
+
+// checkSpecs loads every Hailo spec of the spec directories, as the runtime
+// merges them with the generated one, and reports conflicting device
+// definitions and unreadable specs. A report is only logged when it changed.
+func (m *ResourceMonitor) checkSpecs() {
+	if len(m.specDirs) == 0 {
+		return
+	}
+
+	var problems []string
+	set, err := cdi.LoadSpecs(m.specDirs)
 	if err != nil {
-		log.Printf("Failed to list devices: %v", err)
+		problems = append(problems, err.Error())
+	} else {
+		for path, err := range set.Errors {
+			problems = append(problems, fmt.Sprintf("skipping CDI spec %s: %v", path, err))
+		}
+		for _, conflict := range set.Conflicts {
+			problems = append(problems, "CDI conflict: "+conflict.String())
+		}
+	}
+	sort.Strings(problems)
+
+	report := strings.Join(problems, "\n")
+	if report == m.specReport {
+		return
+	}
+	m.specReport = report
+	if len(problems) == 0 {
+		log.Println("CDI spec conflicts resolved")
+		return
+	}
+	for _, problem := range problems {
+		log.Printf("Warning: %s", problem)
+	}
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// publish health-checks every known device and publishes the result
+func (m *ResourceMonitor) publish() {
+	m.forgetVanished()
+
+	names := make([]string, 0, len(m.known))
+	for name := range m.known {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := m.known[names[i]], m.known[names[j]]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Name < b.Name
+	})
+
+	states := make([]DeviceState, 0, len(names))
+	for _, name := range names {
+		_, vanished := m.vanished[name]
+		state := m.checkDevice(m.known[name], vanished)
+		if vanished {
+			// The spec no longer has the device, so kubelet must stop
+			// allocating it at once; it is dropped when the damped state agrees
+			m.vanished[name] = !state.Healthy
+			state.Healthy = false
+			if state.Reason == "" {
+				state.Reason = errNotDiscovered.Error()
+			}
+		}
+		states = append(states, state)
+	}
+
+	if m.broadcaster.Publish(states) {
+		log.Printf("Published device set change to subscribers")
+	}
+
+	// Only written when a device's damped health changed
+	if m.tracker != nil && m.statusFile != "" {
+		if err := m.tracker.WriteStatusFile(m.statusFile); err != nil {
+			log.Printf("Failed to write health status: %v", err)
+		}
+	}
+}
+
+// forgetVanished drops the devices that were published unhealthy after they
+// disappeared, along with their health state
+func (m *ResourceMonitor) forgetVanished() {
+	for name, reported := range m.vanished {
+		if !reported {
+			continue
+		}
+		log.Printf("Removing vanished device %s from the inventory", name)
+		delete(m.known, name)
+		delete(m.vanished, name)
+		if m.health != nil {
+			m.health.Forget(name)
+		}
+		if m.tracker != nil {
+			m.tracker.Forget(name)
+		}
+	}
+}
+
+// HealthStatus returns the damped health and transition history of every
+// device, or nil when no tracker is configured
+func (m *ResourceMonitor) HealthStatus() []DeviceHealthStatus {
+	if m.tracker == nil {
 		return nil
 	}
-	return strings.Split(strings.TrimSpace(string(output)), "\n")
+	return m.tracker.Status()
+}
+
+// logHealthStatus logs the damped health of every device and its last
+// transition, the status file holds the full history
+func (m *ResourceMonitor) logHealthStatus() {
+	for _, s := range m.HealthStatus() {
+		last := "none"
+		if n := len(s.History); n > 0 {
+			t := s.History[n-1]
+			last = fmt.Sprintf("%s at %s", t.Reason, t.Time.Format(time.RFC3339))
+		}
+		log.Printf("Device %s health: healthy=%v reason=%q failures=%d successes=%d last transition: %s",
+			s.Name, s.Healthy, s.Reason, s.ConsecutiveFailures, s.ConsecutiveSuccesses, last)
+	}
+}
+
+// checkDevice runs the health checks for one device and applies damping.
+// A device that discovery lost fails them even when its node is still there.
+func (m *ResourceMonitor) checkDevice(dev device.Device, vanished bool) DeviceState {
+	var err error
+	if m.health != nil {
+		err = m.health.Check(dev)
+	}
+	if err == nil && vanished {
+		err = errNotDiscovered
+	}
+
+	if m.tracker != nil {
+		healthy, reason := m.tracker.Observe(dev.Name, err)
+		return DeviceState{Device: dev, Healthy: healthy, Reason: reason}
+	}
+
+	if err != nil {
+		log.Printf("Device %s is unhealthy: %v", dev.Name, err)
+		return DeviceState{Device: dev, Healthy: false, Reason: err.Error()}
+	}
+	return DeviceState{Device: dev, Healthy: true}
+}
+
+// discoverDevices asks the configured backend for Hailo devices
+func (m *ResourceMonitor) discoverDevices() ([]device.Device, error) {
+	devices, err := m.discoverer.Discover()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.discoverer.Name(), err)
+	}
+	for i := range devices {
+		enrichTopology(m.sysfsRoot, &devices[i])
+		if devices[i].Model == "" {
+			devices[i].Model = device.DetectModel(devices[i])
+		}
+
+		d := devices[i]
+		log.Printf("Found device %s: pci=%s id=%s:%s model=%q dev=%d:%d driver=%q numa=%d",
+			d.Name, d.PCIAddress, d.VendorID, d.DeviceID, d.Model, d.Major, d.Minor, d.Driver, d.NUMANode)
+	}
+	return devices, nil
 }
@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// newTestMonitor creates a monitor writing its spec below a temporary directory
+func newTestMonitor(t *testing.T, discoverer Discoverer) (*ResourceMonitor, string) {
+	t.Helper()
+	root := t.TempDir()
+	cdiDir := filepath.Join(root, "cdi")
+	if err := os.MkdirAll(cdiDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewResourceMonitor(&Config{
+		CdiDir:     cdiDir,
+		SysfsRoot:  filepath.Join(root, "sys"),
+		DevRoot:    filepath.Join(root, "dev"),
+		Discoverer: discoverer,
+	})
+	return m, filepath.Join(cdiDir, "hailo.json")
+}
+
+func TestRefresh_KeepsInventoryOnDiscoveryError(t *testing.T) {
+	discoverer := &fakeDiscoverer{name: "fake", devices: []device.Device{device.New("hailo0"), device.New("hailo1")}}
+	m, specPath := newTestMonitor(t, discoverer)
+
+	m.refresh("test")
+	spec, err := os.ReadFile(specPath)
+	if err != nil {
+		t.Fatalf("Expected a spec after the first discovery: %v", err)
+	}
+
+	discoverer.devices, discoverer.err = nil, errors.New("hailortcli timed out")
+	m.refresh("test")
+
+	snap, ok := m.Latest()
+	if !ok || len(snap.Devices) != 2 || !snap.Devices[0].Healthy {
+		t.Errorf("Expected the last inventory to stay published, got %+v", snap.Devices)
+	}
+	if after, _ := os.ReadFile(specPath); string(after) != string(spec) {
+		t.Error("Expected the spec to be left untouched after a failed discovery")
+	}
+}
+
+func TestRefresh_ReportsSpecConflicts(t *testing.T) {
+	root := t.TempDir()
+	cdiDir := filepath.Join(root, "etc", "cdi")
+	runDir := filepath.Join(root, "var", "run", "cdi")
+	for _, dir := range []string{cdiDir, runDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	static := `{"cdiVersion": "0.5.0", "kind": "hailo.ai/npu", "devices": [{"name": "hailo0", "containerEdits": {"env": ["A=1"]}}]}`
+	if err := os.WriteFile(filepath.Join(runDir, "static.json"), []byte(static), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewResourceMonitor(&Config{
+		CdiDir:     cdiDir,
+		SpecDirs:   []string{runDir},
+		SysfsRoot:  filepath.Join(root, "sys"),
+		DevRoot:    filepath.Join(root, "dev"),
+		Discoverer: &fakeDiscoverer{name: "fake", devices: []device.Device{device.New("hailo0")}},
+	})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	m.refresh("test")
+	if !strings.Contains(logs.String(), "CDI conflict: device hailo0 is defined by "+filepath.Join(cdiDir, "hailo.json")) {
+		t.Errorf("Expected the conflict with the generated spec to be reported, got:\n%s", logs.String())
+	}
+
+	// An unchanged report is not repeated on every rescan
+	logs.Reset()
+	m.refresh("test")
+	if strings.Contains(logs.String(), "CDI conflict") {
+		t.Errorf("Expected the conflict to be reported once, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RequireService republishes the snapshots of source, reporting every device
+// unhealthy while probe fails. It is meant for devices that are only usable
+// through a host service. The probe runs every interval until ctx is cancelled.
+func RequireService(ctx context.Context, source Source, probe func() error, interval time.Duration) *Broadcaster {
+	gated := NewBroadcaster()
+	updates, unsubscribe := source.Subscribe()
+
+	go func() {
+		defer unsubscribe()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var latest []DeviceState
+		received := false
+		serviceErr := probe()
+		if serviceErr != nil {
+			log.Printf("Service unavailable, reporting all devices unhealthy: %v", serviceErr)
+		}
+
+		publish := func() {
+			if !received {
+				return
+			}
+			states := make([]DeviceState, 0, len(latest))
+			for _, d := range latest {
+				if serviceErr != nil && d.Healthy {
+					d.Healthy = false
+					d.Reason = serviceErr.Error()
+				}
+				states = append(states, d)
+			}
+			gated.Publish(states)
+		}
+
+		for {
+			select {
+			case snap := <-updates:
+				latest, received = snap.Devices, true
+				publish()
+			case <-ticker.C:
+				err := probe()
+				if (err == nil) != (serviceErr == nil) {
+					if err != nil {
+						log.Printf("Service unavailable, reporting all devices unhealthy: %v", err)
+					} else {
+						log.Println("Service available again")
+					}
+				}
+				serviceErr = err
+				publish()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return gated
+}
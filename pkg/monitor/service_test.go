@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequireService_GatesHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var down atomic.Bool
+	down.Store(true)
+	probe := func() error {
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	states := healthyStates("hailo0", "hailo1")
+	states[1].Healthy = false
+	states[1].Reason = "driver unbound"
+	source := NewBroadcaster()
+	source.Publish(states)
+
+	gated := RequireService(ctx, source, probe, 10*time.Millisecond)
+	updates, unsubscribe := gated.Subscribe()
+	defer unsubscribe()
+
+	snap := receive(t, updates)
+	if snap.Devices[0].Healthy || snap.Devices[0].Reason != "connection refused" {
+		t.Errorf("Expected hailo0 unhealthy while the service is down, got %+v", snap.Devices[0])
+	}
+	if snap.Devices[1].Reason != "driver unbound" {
+		t.Errorf("Expected the device's own reason to be kept, got %q", snap.Devices[1].Reason)
+	}
+
+	down.Store(false)
+	snap = receive(t, updates)
+	if !snap.Devices[0].Healthy || snap.Devices[1].Healthy {
+		t.Errorf("Expected only hailo0 to recover with the service, got %+v", snap.Devices)
+	}
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// StaticDevice is one entry of a static device list file
+type StaticDevice struct {
+	Name            string `json:"name"`
+	PCIAddress      string `json:"pciAddress,omitempty"`
+	DeviceID        string `json:"deviceId,omitempty"`
+	Major           uint32 `json:"major,omitempty"`
+	Minor           uint32 `json:"minor,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+	Architecture    string `json:"architecture,omitempty"`
+	// Model overrides the model detected from DeviceID and Architecture
+	Model string `json:"model,omitempty"`
+}
+
+// StaticDeviceList is the on-disk format read by StaticDiscoverer
+type StaticDeviceList struct {
+	Devices []StaticDevice `json:"devices"`
+}
+
+// StaticDiscoverer reports a fixed device list from a JSON file, for lab
+// nodes where neither sysfs nor hailortcli describe the hardware correctly
+type StaticDiscoverer struct {
+	Path string
+}
+
+// NewStaticDiscoverer creates a discoverer reading the given file
+func NewStaticDiscoverer(path string) *StaticDiscoverer {
+	return &StaticDiscoverer{Path: path}
+}
+
+// Name returns the backend name
+func (d *StaticDiscoverer) Name() string {
+	return "static"
+}
+
+// Discover re-reads the file so edits are picked up without a restart
+func (d *StaticDiscoverer) Discover() ([]device.Device, error) {
+	data, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static device list: %w", err)
+	}
+
+	var list StaticDeviceList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse static device list %s: %w", d.Path, err)
+	}
+
+	devices := make([]device.Device, 0, len(list.Devices))
+	for _, entry := range list.Devices {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("static device list %s has an entry without a name", d.Path)
+		}
+		dev := device.New(entry.Name)
+		dev.PCIAddress = entry.PCIAddress
+		dev.DeviceID = entry.DeviceID
+		dev.Major = entry.Major
+		dev.Minor = entry.Minor
+		dev.FirmwareVersion = entry.FirmwareVersion
+		dev.Architecture = entry.Architecture
+		dev.Model = device.NormalizeModel(entry.Model)
+		dev.VendorID = device.HailoVendorID
+		dev.NoSysfs = true
+		devices = append(devices, dev)
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		return devices[i].Index < devices[j].Index
+	})
+	return devices, nil
+}
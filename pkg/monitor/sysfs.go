@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+const (
+	// DefaultSysfsRoot is the mount point of sysfs on the host
+	DefaultSysfsRoot = "/sys"
+
+	// hailoClassDir is the char-dev class created by the hailo_pci driver
+	hailoClassDir = "class/hailo_chardev"
+)
+
+// SysfsDiscoverer finds Hailo devices by walking /sys/class/hailo_chardev
+type SysfsDiscoverer struct {
+	// Root is the sysfs mount point, overridable for tests
+	Root string
+}
+
+// NewSysfsDiscoverer creates a discoverer rooted at the given sysfs path
+func NewSysfsDiscoverer(root string) *SysfsDiscoverer {
+	if root == "" {
+		root = DefaultSysfsRoot
+	}
+	return &SysfsDiscoverer{Root: root}
+}
+
+// Name returns the backend name
+func (d *SysfsDiscoverer) Name() string {
+	return "sysfs"
+}
+
+// Discover returns a record for every entry in the hailo_chardev class.
+// A missing class directory means the driver is not loaded and yields no devices.
+func (d *SysfsDiscoverer) Discover() ([]device.Device, error) {
+	classDir := filepath.Join(d.Root, hailoClassDir)
+
+	entries, err := os.ReadDir(classDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []device.Device{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", classDir, err)
+	}
+
+	devices := make([]device.Device, 0, len(entries))
+	for _, entry := range entries {
+		dev, err := d.readDevice(filepath.Join(classDir, entry.Name()))
+		if err != nil {
+			// Keep the device with whatever we could learn about it
+			log.Printf("Warning: incomplete sysfs data for %s: %v", entry.Name(), err)
+		}
+		devices = append(devices, dev)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Index != devices[j].Index {
+			return devices[i].Index < devices[j].Index
+		}
+		return devices[i].Name < devices[j].Name
+	})
+
+	return devices, nil
+}
+
+// readDevice resolves the char-dev numbers and the backing PCI function of one class entry
+func (d *SysfsDiscoverer) readDevice(entryPath string) (device.Device, error) {
+	dev := device.New(filepath.Base(entryPath))
+
+	major, minor, err := readDevNumbers(filepath.Join(entryPath, "dev"))
+	if err != nil {
+		return dev, err
+	}
+	dev.Major = major
+	dev.Minor = minor
+
+	pciDir, err := filepath.EvalSymlinks(filepath.Join(entryPath, "device"))
+	if err != nil {
+		return dev, fmt.Errorf("failed to resolve PCI device: %w", err)
+	}
+	dev.PCIAddress = filepath.Base(pciDir)
+	readTopology(&dev, pciDir)
+
+	if dev.VendorID, err = readHexID(filepath.Join(pciDir, "vendor")); err != nil {
+		return dev, err
+	}
+	if dev.DeviceID, err = readHexID(filepath.Join(pciDir, "device")); err != nil {
+		return dev, err
+	}
+
+	// An unbound function has no driver link, which is not an error here
+	if target, err := os.Readlink(filepath.Join(pciDir, "driver")); err == nil {
+		dev.Driver = filepath.Base(target)
+	}
+
+	return dev, nil
+}
+
+// readDevNumbers parses a sysfs "dev" file of the form "<major>:<minor>"
+func readDevNumbers(path string) (uint32, uint32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	majorStr, minorStr, ok := strings.Cut(strings.TrimSpace(string(data)), ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed dev file %s: %q", path, data)
+	}
+	major, err := strconv.ParseUint(majorStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid major number in %s: %w", path, err)
+	}
+	minor, err := strconv.ParseUint(minorStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minor number in %s: %w", path, err)
+	}
+	return uint32(major), uint32(minor), nil
+}
+
+// readHexID reads a PCI ID file such as "0x1e60" and returns "1e60"
+func readHexID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(string(data))), "0x"), nil
+}
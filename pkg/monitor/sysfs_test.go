@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakePCIDevice describes a Hailo PCI function to lay out in a fake sysfs tree
+type fakePCIDevice struct {
+	name     string // char-dev name, e.g. hailo0
+	bdf      string // PCI address, e.g. 0000:01:00.0
+	parents  []string
+	deviceID string
+	minor    int
+	driver   string
+	numa     string // numa_node contents, no file when empty
+}
+
+// newFakeSysfs builds a sysfs tree mimicking the hailo_pci driver layout
+func newFakeSysfs(t *testing.T, devices ...fakePCIDevice) string {
+	t.Helper()
+	root := t.TempDir()
+
+	mustMkdir(t, filepath.Join(root, hailoClassDir))
+	for _, d := range devices {
+		addFakeDevice(t, root, d)
+	}
+	return root
+}
+
+// addFakeDevice adds one PCI function and its hailo_chardev class entry
+func addFakeDevice(t *testing.T, root string, d fakePCIDevice) {
+	t.Helper()
+
+	pciRel := filepath.Join(append(append([]string{"devices", "pci0000:00"}, d.parents...), d.bdf)...)
+	pciDir := filepath.Join(root, pciRel)
+	chardevDir := filepath.Join(pciDir, "hailo_chardev", d.name)
+	mustMkdir(t, chardevDir)
+
+	deviceID := d.deviceID
+	if deviceID == "" {
+		deviceID = "0x2864"
+	}
+	mustWrite(t, filepath.Join(pciDir, "vendor"), "0x1e60\n")
+	mustWrite(t, filepath.Join(pciDir, "device"), deviceID+"\n")
+	mustWrite(t, filepath.Join(chardevDir, "dev"), "507:"+strconv.Itoa(d.minor)+"\n")
+	if d.numa != "" {
+		mustWrite(t, filepath.Join(pciDir, "numa_node"), d.numa+"\n")
+	}
+	mustSymlink(t, "../..", filepath.Join(chardevDir, "device"))
+
+	if d.driver != "" {
+		driverDir := filepath.Join(root, "bus", "pci", "drivers", d.driver)
+		mustMkdir(t, driverDir)
+		mustSymlink(t, relPath(t, pciDir, driverDir), filepath.Join(pciDir, "driver"))
+	}
+
+	busDir := filepath.Join(root, "bus", "pci", "devices")
+	mustMkdir(t, busDir)
+	mustSymlink(t, relPath(t, busDir, pciDir), filepath.Join(busDir, d.bdf))
+
+	classEntry := filepath.Join(root, hailoClassDir, d.name)
+	mustSymlink(t, relPath(t, filepath.Dir(classEntry), chardevDir), classEntry)
+}
+
+func TestSysfsDiscoverer_Discover(t *testing.T) {
+	root := newFakeSysfs(t,
+		fakePCIDevice{name: "hailo1", bdf: "0000:02:00.0", parents: []string{"0000:00:1c.1"}, minor: 1, driver: "hailo"},
+		fakePCIDevice{name: "hailo0", bdf: "0000:01:00.0", parents: []string{"0000:00:1c.0"}, minor: 0, driver: "hailo", numa: "1"},
+	)
+
+	devices, err := NewSysfsDiscoverer(root).Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d: %+v", len(devices), devices)
+	}
+
+	d := devices[0]
+	if d.Name != "hailo0" || d.Index != 0 || d.DevPath != "/dev/hailo0" {
+		t.Errorf("Unexpected name fields: %+v", d)
+	}
+	if d.PCIAddress != "0000:01:00.0" {
+		t.Errorf("Expected PCI address 0000:01:00.0, got %q", d.PCIAddress)
+	}
+	if d.VendorID != "1e60" || d.DeviceID != "2864" {
+		t.Errorf("Unexpected PCI IDs %s:%s", d.VendorID, d.DeviceID)
+	}
+	if d.Major != 507 || d.Minor != 0 {
+		t.Errorf("Unexpected dev numbers %d:%d", d.Major, d.Minor)
+	}
+	if d.Driver != "hailo" {
+		t.Errorf("Expected driver hailo, got %q", d.Driver)
+	}
+	if d.NUMANode != 1 || len(d.PCIPath) != 1 || d.PCIPath[0] != "0000:00:1c.0" {
+		t.Errorf("Unexpected topology: numa=%d path=%v", d.NUMANode, d.PCIPath)
+	}
+	if devices[1].Name != "hailo1" || devices[1].Minor != 1 || devices[1].NUMANode != -1 {
+		t.Errorf("Unexpected second device: %+v", devices[1])
+	}
+}
+
+func TestSysfsDiscoverer_MissingClassDir(t *testing.T) {
+	devices, err := NewSysfsDiscoverer(t.TempDir()).Discover()
+	if err != nil {
+		t.Fatalf("Expected no error for missing class dir, got %v", err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("Expected no devices, got %+v", devices)
+	}
+}
+
+func TestSysfsDiscoverer_UnboundDriver(t *testing.T) {
+	root := newFakeSysfs(t, fakePCIDevice{name: "hailo0", bdf: "0000:01:00.0", minor: 0})
+
+	devices, err := NewSysfsDiscoverer(root).Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got %d", len(devices))
+	}
+	if devices[0].Driver != "" {
+		t.Errorf("Expected empty driver for unbound device, got %q", devices[0].Driver)
+	}
+}
+
+func mustMkdir(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Failed to symlink %s -> %s: %v", link, target, err)
+	}
+}
+
+func relPath(t *testing.T, from, to string) string {
+	t.Helper()
+	rel, err := filepath.Rel(from, to)
+	if err != nil {
+		t.Fatalf("Failed to compute relative path: %v", err)
+	}
+	return rel
+}
@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// readTopology fills in the NUMA node and PCIe bridge chain of a PCI function
+// from its resolved sysfs directory, e.g.
+// /sys/devices/pci0000:00/0000:00:01.0/0000:02:00.0/0000:03:01.0/0000:05:00.0
+func readTopology(dev *device.Device, pciDir string) {
+	dev.NUMANode = readNUMANode(filepath.Join(pciDir, "numa_node"))
+
+	var bridges []string
+	for _, component := range strings.Split(filepath.ToSlash(pciDir), "/") {
+		if pciAddressPattern.MatchString(component) && len(component) == len("0000:00:00.0") {
+			bridges = append(bridges, component)
+		}
+	}
+	// The last component is the device itself
+	if len(bridges) > 0 {
+		bridges = bridges[:len(bridges)-1]
+	}
+	dev.PCIPath = bridges
+}
+
+// enrichTopology resolves the topology of devices reported by backends that
+// only know the PCI address, through /sys/bus/pci/devices/<bdf>
+func enrichTopology(sysfsRoot string, dev *device.Device) {
+	if dev.PCIAddress == "" || dev.NUMANode >= 0 || len(dev.PCIPath) > 0 {
+		return
+	}
+
+	busPath := filepath.Join(sysfsRoot, "bus", "pci", "devices", dev.PCIAddress)
+	pciDir, err := filepath.EvalSymlinks(busPath)
+	if err != nil {
+		// Still try the NUMA node, the only part Topology Manager needs
+		dev.NUMANode = readNUMANode(filepath.Join(busPath, "numa_node"))
+		return
+	}
+	readTopology(dev, pciDir)
+}
+
+// readNUMANode parses a numa_node file, returning -1 when it is missing or
+// when the platform does not report locality
+func readNUMANode(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	node, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || node < 0 {
+		return -1
+	}
+	return node
+}
@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+func TestEnrichTopology_FromBusPath(t *testing.T) {
+	root := newFakeSysfs(t, fakePCIDevice{
+		name:    "hailo0",
+		bdf:     "0000:05:00.0",
+		parents: []string{"0000:00:01.0", "0000:02:00.0", "0000:03:01.0"},
+		numa:    "1",
+	})
+
+	// hailortcli and static backends only know the PCI address
+	dev := device.New("hailo0")
+	dev.PCIAddress = "0000:05:00.0"
+	enrichTopology(root, &dev)
+
+	if dev.NUMANode != 1 {
+		t.Errorf("Expected NUMA node 1, got %d", dev.NUMANode)
+	}
+	expected := []string{"0000:00:01.0", "0000:02:00.0", "0000:03:01.0"}
+	if len(dev.PCIPath) != len(expected) {
+		t.Fatalf("Expected PCI path %v, got %v", expected, dev.PCIPath)
+	}
+	for i := range expected {
+		if dev.PCIPath[i] != expected[i] {
+			t.Errorf("Expected PCI path %v, got %v", expected, dev.PCIPath)
+		}
+	}
+}
+
+func TestEnrichTopology_UnknownNUMA(t *testing.T) {
+	root := newFakeSysfs(t, fakePCIDevice{name: "hailo0", bdf: "0000:01:00.0", numa: "-1"})
+
+	dev := device.New("hailo0")
+	dev.PCIAddress = "0000:01:00.0"
+	enrichTopology(root, &dev)
+	if dev.NUMANode != -1 {
+		t.Errorf("Expected unknown NUMA node, got %d", dev.NUMANode)
+	}
+
+	missing := device.New("hailo1")
+	missing.PCIAddress = "0000:09:00.0"
+	enrichTopology(root, &missing)
+	if missing.NUMANode != -1 || len(missing.PCIPath) != 0 {
+		t.Errorf("Expected no topology for unknown PCI address, got %+v", missing)
+	}
+}
@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+// Uevent is a kernel object event as broadcast on the uevent netlink socket
+type Uevent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	Env       map[string]string
+}
+
+// ParseUevent decodes a raw kernel uevent message of the form
+// "action@devpath\0KEY=VALUE\0...". Messages relayed by udevd start with
+// "libudev" and carry a binary header, those are rejected.
+func ParseUevent(msg []byte) (*Uevent, error) {
+	fields := bytes.Split(msg, []byte{0})
+	if len(fields) == 0 || len(fields[0]) == 0 {
+		return nil, fmt.Errorf("empty uevent message")
+	}
+	if bytes.HasPrefix(fields[0], []byte("libudev")) {
+		return nil, fmt.Errorf("udev relayed message, not a kernel uevent")
+	}
+
+	action, devPath, ok := strings.Cut(string(fields[0]), "@")
+	if !ok {
+		return nil, fmt.Errorf("malformed uevent header %q", fields[0])
+	}
+
+	ev := &Uevent{
+		Action:  action,
+		DevPath: devPath,
+		Env:     make(map[string]string),
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(string(field), "=")
+		if !ok {
+			continue
+		}
+		ev.Env[key] = value
+	}
+	ev.Subsystem = ev.Env["SUBSYSTEM"]
+
+	return ev, nil
+}
+
+// IsHailoEvent reports whether the event concerns a Hailo device, either its
+// hailo_chardev node or the underlying PCI function
+func (e *Uevent) IsHailoEvent() bool {
+	switch e.Subsystem {
+	case "hailo_chardev":
+		return true
+	case "pci":
+		// PCI_ID is "VENDOR:DEVICE" in uppercase hex
+		vendor, _, _ := strings.Cut(e.Env["PCI_ID"], ":")
+		return strings.EqualFold(vendor, device.HailoVendorID) || e.Env["DRIVER"] == "hailo"
+	default:
+		return false
+	}
+}
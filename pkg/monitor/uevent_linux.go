@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ueventBufferSize fits the largest uevent the kernel sends (UEVENT_BUFFER_SIZE)
+const ueventBufferSize = 2048
+
+// UeventSocket receives kernel uevents over NETLINK_KOBJECT_UEVENT
+type UeventSocket struct {
+	file *os.File
+}
+
+// OpenUeventSocket subscribes to the kernel uevent multicast group.
+// Kernel uevents are only delivered in the initial network namespace,
+// so the plugin needs hostNetwork for this to see anything.
+func OpenUeventSocket() (*UeventSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netlink socket: %w", err)
+	}
+
+	addr := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: 1, // kernel uevent group
+	}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	// Wrapping the non-blocking fd lets Close interrupt a pending Read
+	return &UeventSocket{file: os.NewFile(uintptr(fd), "uevent")}, nil
+}
+
+// Read blocks until the next raw uevent message arrives
+func (s *UeventSocket) Read() ([]byte, error) {
+	buf := make([]byte, ueventBufferSize)
+	n, err := s.file.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Close releases the socket and unblocks any pending Read
+func (s *UeventSocket) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package monitor
+
+import "fmt"
+
+// UeventSocket is only available on Linux
+type UeventSocket struct{}
+
+// OpenUeventSocket always fails outside Linux so callers fall back to fsnotify
+func OpenUeventSocket() (*UeventSocket, error) {
+	return nil, fmt.Errorf("kernel uevents are not supported on this platform")
+}
+
+// Read is never reached since the socket cannot be opened
+func (s *UeventSocket) Read() ([]byte, error) {
+	return nil, fmt.Errorf("kernel uevents are not supported on this platform")
+}
+
+// Close is a no-op
+func (s *UeventSocket) Close() error {
+	return nil
+}
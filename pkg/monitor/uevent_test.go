@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+)
+
+// rawUevent builds a kernel uevent message from a header and KEY=VALUE pairs
+func rawUevent(header string, env ...string) []byte {
+	return []byte(strings.Join(append([]string{header}, env...), "\x00") + "\x00")
+}
+
+func TestParseUevent(t *testing.T) {
+	msg := rawUevent("remove@/devices/pci0000:00/0000:00:1c.0/0000:01:00.0/hailo_chardev/hailo0",
+		"ACTION=remove",
+		"DEVPATH=/devices/pci0000:00/0000:00:1c.0/0000:01:00.0/hailo_chardev/hailo0",
+		"SUBSYSTEM=hailo_chardev",
+		"MAJOR=507",
+		"MINOR=0",
+		"DEVNAME=hailo0",
+		"SEQNUM=4242",
+	)
+
+	ev, err := ParseUevent(msg)
+	if err != nil {
+		t.Fatalf("ParseUevent failed: %v", err)
+	}
+	if ev.Action != "remove" || ev.Subsystem != "hailo_chardev" {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+	if ev.Env["DEVNAME"] != "hailo0" || ev.Env["MAJOR"] != "507" {
+		t.Errorf("Environment not parsed: %v", ev.Env)
+	}
+	if !ev.IsHailoEvent() {
+		t.Error("hailo_chardev event should be a Hailo event")
+	}
+}
+
+func TestUevent_IsHailoEvent(t *testing.T) {
+	testCases := []struct {
+		name     string
+		msg      []byte
+		expected bool
+	}{
+		{"pci unbind", rawUevent("unbind@/devices/pci0000:00/0000:00:1c.0/0000:01:00.0", "SUBSYSTEM=pci", "PCI_ID=1E60:2864"), true},
+		{"pci bind by driver", rawUevent("bind@/devices/pci0000:00/0000:00:1c.0/0000:01:00.0", "SUBSYSTEM=pci", "DRIVER=hailo"), true},
+		{"other pci device", rawUevent("add@/devices/pci0000:00/0000:00:1f.3", "SUBSYSTEM=pci", "PCI_ID=8086:A348"), false},
+		{"usb device", rawUevent("add@/devices/usb1/1-1", "SUBSYSTEM=usb"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev, err := ParseUevent(tc.msg)
+			if err != nil {
+				t.Fatalf("ParseUevent failed: %v", err)
+			}
+			if ev.IsHailoEvent() != tc.expected {
+				t.Errorf("Expected IsHailoEvent=%v for %+v", tc.expected, ev)
+			}
+		})
+	}
+}
+
+func TestParseUevent_Invalid(t *testing.T) {
+	for _, msg := range [][]byte{
+		nil,
+		[]byte("libudev\x00\xfe\xed\xca\xfe"),
+		rawUevent("no-at-sign", "SUBSYSTEM=pci"),
+	} {
+		if _, err := ParseUevent(msg); err == nil {
+			t.Errorf("Expected error for %q", msg)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// visibleDevicesEnv lists the devices allocated to a container for HailoRT
+const visibleDevicesEnv = "HAILO_VISIBLE_DEVICES"
+
+// AllocationMode selects how allocated devices are handed to the container runtime
+type AllocationMode string
+
+const (
+	// AllocationModeCDIDevices uses the native ContainerAllocateResponse.CDIDevices field
+	AllocationModeCDIDevices AllocationMode = "cdi-devices"
+	// AllocationModeAnnotations uses cdi.k8s.io/<plugin>_<device> annotations
+	AllocationModeAnnotations AllocationMode = "cdi-annotations"
+	// AllocationModeBoth sets the field and the annotations
+	AllocationModeBoth AllocationMode = "both"
+	// AllocationModeLegacy sets device nodes, mounts and env directly for
+	// runtimes with CDI disabled
+	AllocationModeLegacy AllocationMode = "legacy"
+	// AllocationModeAuto picks a mode from the kubelet version
+	AllocationModeAuto AllocationMode = "auto"
+)
+
+const (
+	// cdiAnnotationPrefix is the annotation prefix understood by CDI-enabled runtimes
+	cdiAnnotationPrefix = "cdi.k8s.io/"
+	// cdiAnnotationPluginName identifies this plugin in annotation keys
+	cdiAnnotationPluginName = "hailo-device-plugin"
+)
+
+// cdiDevicesMinKubeletMinor is the first release with the DevicePluginCDIDevices
+// feature gate enabled by default (beta in v1.29)
+const cdiDevicesMinKubeletMinor = 29
+
+var (
+	// annotationNamePattern is the Kubernetes qualified name syntax of the part after the prefix
+	annotationNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	kubeletVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+)
+
+// ParseAllocationMode validates a mode given on the command line
+func ParseAllocationMode(s string) (AllocationMode, error) {
+	switch mode := AllocationMode(s); mode {
+	case AllocationModeCDIDevices, AllocationModeAnnotations, AllocationModeBoth, AllocationModeLegacy, AllocationModeAuto:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown allocation mode %q (want cdi-devices, cdi-annotations, both, legacy or auto)", s)
+	}
+}
+
+// ResolveAllocationMode turns auto into a concrete mode. Kubelets from v1.29
+// pass CDIDevices to the runtime; older ones only forward annotations. An
+// unknown version gets both, which every CDI-enabled runtime understands.
+func ResolveAllocationMode(mode AllocationMode, kubeletVersion string) AllocationMode {
+	if mode != AllocationModeAuto && mode != "" {
+		return mode
+	}
+
+	m := kubeletVersionPattern.FindStringSubmatch(strings.TrimSpace(kubeletVersion))
+	if m == nil {
+		return AllocationModeBoth
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major > 1 || (major == 1 && minor >= cdiDevicesMinKubeletMinor) {
+		return AllocationModeCDIDevices
+	}
+	return AllocationModeAnnotations
+}
+
+// cdiAnnotationKey returns the spec-compliant annotation key for one device
+func cdiAnnotationKey(deviceID string) (string, error) {
+	name := cdiAnnotationPluginName + "_" + deviceID
+	if len(name) > 63 || !annotationNamePattern.MatchString(name) {
+		return "", fmt.Errorf("device ID %q does not form a valid CDI annotation key", deviceID)
+	}
+	return cdiAnnotationPrefix + name, nil
+}
+
+// cdiContainerResponse hands the qualified CDI names of deviceIDs to the runtime
+// in the way selected by mode
+func cdiContainerResponse(mode AllocationMode, deviceIDs []string) (*pluginapi.ContainerAllocateResponse, error) {
+	response := &pluginapi.ContainerAllocateResponse{}
+
+	useField := mode == AllocationModeCDIDevices || mode == AllocationModeBoth
+	useAnnotations := mode == AllocationModeAnnotations || mode == AllocationModeBoth
+	if !useField && !useAnnotations {
+		return nil, fmt.Errorf("unresolved allocation mode %q", mode)
+	}
+
+	for _, id := range deviceIDs {
+		name := cdi.QualifiedName(id)
+
+		if useField {
+			response.CDIDevices = append(response.CDIDevices, &pluginapi.CDIDevice{Name: name})
+		}
+
+		if useAnnotations {
+			key, err := cdiAnnotationKey(id)
+			if err != nil {
+				return nil, err
+			}
+			if response.Annotations == nil {
+				response.Annotations = make(map[string]string)
+			}
+			response.Annotations[key] = name
+		}
+	}
+
+	return response, nil
+}
+
+// legacyContainerResponse translates the CDI container edits of the given
+// devices into kubelet DeviceSpecs, Mounts and Envs. The edits come from
+// the CDI generator, so the container sees what a CDI-enabled runtime would
+// inject, with two differences kubelet cannot express:
+//   - the private tmpfs over /sys/class/hailo_chardev is replaced by a
+//     read-only bind of a host directory holding only the allocated entries,
+//     see legacyChardevDir
+//   - hooks are not run, so the linker cache is not updated for injected
+//     libraries
+func legacyContainerResponse(generator *cdi.Generator, devices []device.Device, chardevRoot string) (*pluginapi.ContainerAllocateResponse, error) {
+	spec := generator.BuildSpec(devices)
+	response := &pluginapi.ContainerAllocateResponse{}
+
+	edits := make([]*cdi.ContainerEdits, 0, len(spec.Devices)+1)
+	if spec.ContainerEdits != nil {
+		edits = append(edits, spec.ContainerEdits)
+	}
+	for _, dev := range spec.Devices {
+		// The all device and groups repeat the edits of their members
+		if cdi.IsComposite(dev) {
+			continue
+		}
+		edits = append(edits, &dev.ContainerEdits)
+	}
+
+	for _, e := range edits {
+		for _, node := range e.DeviceNodes {
+			hostPath := node.HostPath
+			if hostPath == "" {
+				hostPath = node.Path
+			}
+			permissions := node.Permissions
+			if permissions == "" {
+				permissions = "rw"
+			}
+			response.Devices = append(response.Devices, &pluginapi.DeviceSpec{
+				ContainerPath: node.Path,
+				HostPath:      hostPath,
+				Permissions:   permissions,
+			})
+		}
+
+		for _, m := range e.Mounts {
+			switch {
+			case m.ContainerPath == cdi.ChardevClassPath:
+				dir, err := legacyChardevDir(chardevRoot, generator.SysfsRoot, device.Names(devices))
+				if err != nil {
+					return nil, status.Errorf(codes.Internal, "failed to isolate %s: %v", cdi.ChardevClassPath, err)
+				}
+				response.Mounts = append(response.Mounts, &pluginapi.Mount{
+					ContainerPath: cdi.ChardevClassPath,
+					HostPath:      dir,
+					ReadOnly:      true,
+				})
+			case strings.HasPrefix(m.ContainerPath, cdi.ChardevClassPath+"/"):
+				// The bound directory already holds the device's entry
+			case m.Type != "" && m.Type != "bind":
+				// Kubelet mounts can only bind host paths
+				log.Printf("Legacy allocation cannot apply %s mount at %s", m.Type, m.ContainerPath)
+			default:
+				response.Mounts = append(response.Mounts, &pluginapi.Mount{
+					ContainerPath: m.ContainerPath,
+					HostPath:      m.HostPath,
+					ReadOnly:      hasOption(m.Options, "ro"),
+				})
+			}
+		}
+
+		for _, env := range e.Env {
+			key, value, ok := strings.Cut(env, "=")
+			if !ok {
+				continue
+			}
+			if response.Envs == nil {
+				response.Envs = make(map[string]string)
+			}
+			response.Envs[key] = value
+		}
+
+		for _, hook := range e.Hooks {
+			// Kubelet has no way to pass OCI hooks to the runtime
+			log.Printf("Legacy allocation cannot apply %s hook %s", hook.HookName, hook.Path)
+		}
+	}
+
+	return response, nil
+}
+
+// hasOption reports whether a mount option list contains opt
+func hasOption(options []string, opt string) bool {
+	for _, o := range options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDevices rejects ids that are not in the inventory (NotFound) or
+// whose device is currently unhealthy (FailedPrecondition)
+func validateDevices(states map[string]monitor.DeviceState, ids []string) error {
+	for _, id := range ids {
+		state, ok := states[id]
+		if !ok {
+			return status.Errorf(codes.NotFound, "device %s is not present on this node", id)
+		}
+		if !state.Healthy {
+			reason := state.Reason
+			if reason == "" {
+				reason = "unknown reason"
+			}
+			return status.Errorf(codes.FailedPrecondition, "device %s is unhealthy: %s", id, reason)
+		}
+	}
+	return nil
+}
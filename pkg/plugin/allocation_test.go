@@ -0,0 +1,441 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestResolveAllocationMode(t *testing.T) {
+	testCases := []struct {
+		mode     AllocationMode
+		version  string
+		expected AllocationMode
+	}{
+		{AllocationModeAuto, "v1.31.6+k3s1", AllocationModeCDIDevices},
+		{AllocationModeAuto, "1.29.0", AllocationModeCDIDevices},
+		{AllocationModeAuto, "v1.28.4", AllocationModeAnnotations},
+		{AllocationModeAuto, "", AllocationModeBoth},
+		{AllocationModeAuto, "garbage", AllocationModeBoth},
+		{AllocationModeAnnotations, "v1.31.0", AllocationModeAnnotations},
+		{"", "v1.27.0", AllocationModeAnnotations},
+	}
+
+	for _, tc := range testCases {
+		if got := ResolveAllocationMode(tc.mode, tc.version); got != tc.expected {
+			t.Errorf("ResolveAllocationMode(%q, %q): expected %s, got %s", tc.mode, tc.version, tc.expected, got)
+		}
+	}
+}
+
+func TestParseAllocationMode(t *testing.T) {
+	for _, valid := range []string{"cdi-devices", "cdi-annotations", "both", "auto"} {
+		if _, err := ParseAllocationMode(valid); err != nil {
+			t.Errorf("Expected %q to be valid: %v", valid, err)
+		}
+	}
+	if _, err := ParseAllocationMode("annotation"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestAllocate_Modes(t *testing.T) {
+	req := &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{"hailo0", "hailo1"}},
+		},
+	}
+
+	testCases := []struct {
+		mode            AllocationMode
+		wantField       bool
+		wantAnnotations bool
+	}{
+		{AllocationModeCDIDevices, true, false},
+		{AllocationModeAnnotations, false, true},
+		{AllocationModeBoth, true, true},
+	}
+
+	updates := monitor.NewBroadcaster()
+	updates.Publish(deviceStates("hailo0", "hailo1"))
+
+	for _, tc := range testCases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			plugin := &HailoDevicePlugin{Monitor: updates, AllocationMode: tc.mode}
+			resp, err := plugin.Allocate(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Allocate failed: %v", err)
+			}
+			container := resp.ContainerResponses[0]
+			if got := container.Envs[visibleDevicesEnv]; got != "/dev/hailo0,/dev/hailo1" {
+				t.Errorf("Unexpected %s: %q", visibleDevicesEnv, got)
+			}
+
+			if tc.wantField {
+				if len(container.CDIDevices) != 2 || container.CDIDevices[1].Name != "hailo.ai/npu=hailo1" {
+					t.Errorf("Unexpected CDIDevices: %v", container.CDIDevices)
+				}
+			} else if len(container.CDIDevices) != 0 {
+				t.Errorf("Expected no CDIDevices, got %v", container.CDIDevices)
+			}
+
+			if tc.wantAnnotations {
+				if container.Annotations["cdi.k8s.io/hailo-device-plugin_hailo0"] != "hailo.ai/npu=hailo0" {
+					t.Errorf("Unexpected annotations: %v", container.Annotations)
+				}
+				for key := range container.Annotations {
+					if !strings.HasPrefix(key, "cdi.k8s.io/hailo-device-plugin_") {
+						t.Errorf("Unexpected annotation key %q", key)
+					}
+				}
+			} else if len(container.Annotations) != 0 {
+				t.Errorf("Expected no annotations, got %v", container.Annotations)
+			}
+		})
+	}
+}
+
+func TestAllocate_RejectsUnknownAndUnhealthy(t *testing.T) {
+	states := deviceStates("hailo0", "hailo1")
+	states[1].Healthy = false
+	states[1].Reason = "driver unbound"
+	updates := monitor.NewBroadcaster()
+	updates.Publish(states)
+
+	testCases := []struct {
+		ids     []string
+		code    codes.Code
+		message string
+	}{
+		{[]string{"hailo0", "hailo3"}, codes.NotFound, "device hailo3 is not present"},
+		{[]string{"hailo1"}, codes.FailedPrecondition, "device hailo1 is unhealthy: driver unbound"},
+	}
+
+	plugin := &HailoDevicePlugin{Monitor: updates, AllocationMode: AllocationModeCDIDevices}
+	for _, tc := range testCases {
+		_, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+			ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: tc.ids}},
+		})
+		st, _ := status.FromError(err)
+		if st.Code() != tc.code || !strings.Contains(st.Message(), tc.message) {
+			t.Errorf("Allocate(%v): expected %s %q, got %v", tc.ids, tc.code, tc.message, err)
+		}
+	}
+}
+
+func TestAllocate_AuditsWholeRequest(t *testing.T) {
+	updates := monitor.NewBroadcaster()
+	updates.Publish(deviceStates("hailo0", "hailo1"))
+	plugin := &HailoDevicePlugin{Monitor: updates, AllocationMode: AllocationModeCDIDevices}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	audits := func() []AllocationAudit {
+		var records []AllocationAudit
+		for _, line := range strings.Split(logs.String(), "\n") {
+			_, data, ok := strings.Cut(line, "allocation-audit ")
+			if !ok {
+				continue
+			}
+			var record AllocationAudit
+			if err := json.Unmarshal([]byte(data), &record); err != nil {
+				t.Fatalf("Invalid audit record %q: %v", data, err)
+			}
+			records = append(records, record)
+		}
+		logs.Reset()
+		return records
+	}
+
+	// The second container fails, so kubelet gets nothing for the first either
+	_, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{"hailo0"}},
+			{DevicesIDs: []string{"hailo3"}},
+		},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound, got %v", err)
+	}
+	records := audits()
+	if len(records) != 2 {
+		t.Fatalf("Expected a record per container, got %+v", records)
+	}
+	for _, r := range records {
+		if r.Result != auditResultRejected || r.Code != codes.NotFound.String() {
+			t.Errorf("Expected every container to be rejected, got %+v", r)
+		}
+	}
+
+	if _, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{"hailo0"}},
+			{DevicesIDs: []string{"hailo1"}},
+		},
+	}); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	records = audits()
+	if len(records) != 2 || records[0].Result != auditResultGranted || records[1].Devices[0] != "hailo1" {
+		t.Errorf("Expected both containers to be granted, got %+v", records)
+	}
+}
+
+func TestAllocate_WithoutMonitorUsesCDISpec(t *testing.T) {
+	cdiDir := t.TempDir()
+	if _, err := cdi.GenerateCDI([]device.Device{device.New("hailo0")}, cdiDir); err != nil {
+		t.Fatalf("GenerateCDI failed: %v", err)
+	}
+
+	plugin := &HailoDevicePlugin{CdiDir: cdiDir, AllocationMode: AllocationModeCDIDevices}
+	request := func(id string) error {
+		_, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+			ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{id}}},
+		})
+		return err
+	}
+
+	if err := request("hailo0"); err != nil {
+		t.Errorf("Expected hailo0 from the CDI spec to be allocatable: %v", err)
+	}
+	if status.Code(request("hailo1")) != codes.NotFound {
+		t.Error("Expected NotFound for a device missing from the CDI spec")
+	}
+}
+
+func TestCDIAnnotationKey_Invalid(t *testing.T) {
+	for _, id := range []string{"hailo/0", strings.Repeat("x", 60), "hailo0-"} {
+		if _, err := cdiAnnotationKey(id); err == nil {
+			t.Errorf("Expected error for device ID %q", id)
+		}
+	}
+}
+
+// containerView is what a container ends up with, independent of how the
+// runtime was told about it
+type containerView struct {
+	devices map[string]string // container path -> host path and permissions
+	mounts  map[string]string // container path -> host path and access
+	env     map[string]string
+	// chardev maps the entries visible in /sys/class/hailo_chardev to the
+	// host sysfs directory they resolve to
+	chardev map[string]string
+}
+
+func newContainerView() containerView {
+	return containerView{devices: map[string]string{}, mounts: map[string]string{}, env: map[string]string{}, chardev: map[string]string{}}
+}
+
+// newFakeChardevSysfs creates a sysfs root whose hailo_chardev class links
+// every named device to its PCI function, like the kernel does
+func newFakeChardevSysfs(t *testing.T, names ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	classDir := filepath.Join(root, "class", "hailo_chardev")
+	if err := os.MkdirAll(classDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		rel := fmt.Sprintf("devices/pci0000:00/0000:0%d:00.0/hailo_chardev/%s", i+1, name)
+		if err := os.MkdirAll(filepath.Join(root, rel), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("../../"+rel, filepath.Join(classDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// resolveSysfs resolves a container sysfs path against the fake sysfs root
+func resolveSysfs(t *testing.T, sysfsRoot, path string) string {
+	t.Helper()
+	resolved, err := filepath.EvalSymlinks(filepath.Join(sysfsRoot, strings.TrimPrefix(path, "/sys")))
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %v", path, err)
+	}
+	return resolved
+}
+
+// viewFromSpec applies the global and per-device edits a CDI runtime would inject
+func viewFromSpec(t *testing.T, spec *cdi.CDISpec, names []string, sysfsRoot string) containerView {
+	view := newContainerView()
+	edits := []*cdi.ContainerEdits{spec.ContainerEdits}
+	for _, name := range names {
+		for _, dev := range spec.Devices {
+			if dev.Name == name {
+				edits = append(edits, &dev.ContainerEdits)
+			}
+		}
+	}
+
+	hidden := false
+	for _, e := range edits {
+		for _, n := range e.DeviceNodes {
+			view.devices[n.Path] = n.HostPath + ":" + n.Permissions
+		}
+		for _, m := range e.Mounts {
+			switch {
+			case m.ContainerPath == cdi.ChardevClassPath && m.Type == "tmpfs":
+				hidden = true
+			case strings.HasPrefix(m.ContainerPath, cdi.ChardevClassPath+"/"):
+				view.chardev[filepath.Base(m.ContainerPath)] = resolveSysfs(t, sysfsRoot, m.HostPath)
+			default:
+				access := "rw"
+				if hasOption(m.Options, "ro") {
+					access = "ro"
+				}
+				view.mounts[m.ContainerPath] = m.HostPath + ":" + access
+			}
+		}
+		for _, env := range e.Env {
+			key, value, _ := strings.Cut(env, "=")
+			view.env[key] = value
+		}
+	}
+	if !hidden {
+		t.Fatal("Expected the spec to hide the host's chardev entries")
+	}
+	return view
+}
+
+// viewFromLegacy collects what kubelet would pass for a legacy response
+func viewFromLegacy(t *testing.T, resp *pluginapi.ContainerAllocateResponse, sysfsRoot string) containerView {
+	view := newContainerView()
+	for _, d := range resp.Devices {
+		view.devices[d.ContainerPath] = d.HostPath + ":" + d.Permissions
+	}
+
+	bound := false
+	for _, m := range resp.Mounts {
+		if m.ContainerPath != cdi.ChardevClassPath {
+			access := "rw"
+			if m.ReadOnly {
+				access = "ro"
+			}
+			view.mounts[m.ContainerPath] = m.HostPath + ":" + access
+			continue
+		}
+
+		// The bound links are resolved inside the container's sysfs
+		bound = true
+		entries, err := os.ReadDir(m.HostPath)
+		if err != nil {
+			t.Fatalf("Failed to read the bound chardev directory: %v", err)
+		}
+		for _, entry := range entries {
+			target, err := os.Readlink(filepath.Join(m.HostPath, entry.Name()))
+			if err != nil {
+				t.Fatalf("Expected %s to be a symlink: %v", entry.Name(), err)
+			}
+			view.chardev[entry.Name()] = resolveSysfs(t, sysfsRoot, path.Join(cdi.ChardevClassPath, target))
+		}
+	}
+	if !bound {
+		t.Fatal("Expected the legacy response to hide the host's chardev entries")
+	}
+
+	for k, v := range resp.Envs {
+		view.env[k] = v
+	}
+	return view
+}
+
+func TestAllocate_LegacyMatchesCDIView(t *testing.T) {
+	all := deviceStates("hailo0", "hailo1", "hailo2")
+	updates := monitor.NewBroadcaster()
+	updates.Publish(all)
+
+	sysfsRoot := newFakeChardevSysfs(t, "hailo0", "hailo1", "hailo2")
+	generator := cdi.NewGenerator(t.TempDir(), sysfsRoot)
+	env, err := cdi.ParseEnvTemplates([]string{"HAILO_DEVICE_COUNT={{.Count}}", "HAILO_DEVICE_NAMES={{.Names}}"}, cdi.DefaultDeviceEnv)
+	if err != nil {
+		t.Fatalf("ParseEnvTemplates failed: %v", err)
+	}
+	generator.Env = env
+	plugin := &HailoDevicePlugin{
+		Monitor:           updates,
+		AllocationMode:    AllocationModeLegacy,
+		Generator:         generator,
+		LegacyChardevRoot: t.TempDir(),
+	}
+	allocate := func(ids ...string) *pluginapi.ContainerAllocateResponse {
+		t.Helper()
+		resp, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+			ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: ids}},
+		})
+		if err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+		return resp.ContainerResponses[0]
+	}
+
+	container := allocate("hailo0", "hailo2")
+	if len(container.CDIDevices) != 0 || len(container.Annotations) != 0 {
+		t.Errorf("Legacy mode must not reference CDI: %v", container)
+	}
+	if len(container.Devices) != 2 || container.Devices[0].HostPath != "/dev/hailo0" || container.Devices[0].Permissions != "rw" {
+		t.Errorf("Unexpected device specs: %v", container.Devices)
+	}
+
+	// The spec a runtime would read covers every device, the container only gets its two
+	var devices []device.Device
+	for _, s := range all {
+		devices = append(devices, s.Device)
+	}
+	expected := viewFromSpec(t, generator.BuildSpec(devices), []string{"hailo0", "hailo2"}, sysfsRoot)
+	// Every mode passes the global env and the combined device list through Envs
+	plugin.AllocationMode = AllocationModeCDIDevices
+	for key, value := range allocate("hailo0", "hailo2").Envs {
+		expected.env[key] = value
+	}
+	plugin.AllocationMode = AllocationModeLegacy
+	if expected.env["HAILO_DEVICE_COUNT"] != "2" || expected.env["HAILO_DEVICE_NAMES"] != "hailo0,hailo2" {
+		t.Errorf("Expected global env of the allocated devices, got %v", expected.env)
+	}
+	if expected.env[visibleDevicesEnv] != "/dev/hailo0,/dev/hailo2" {
+		t.Errorf("Unexpected %s: %q", visibleDevicesEnv, expected.env[visibleDevicesEnv])
+	}
+	got := viewFromLegacy(t, container, sysfsRoot)
+
+	if len(got.chardev) != 2 {
+		t.Errorf("Expected only the allocated chardev entries, got %v", got.chardev)
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Legacy view differs from CDI view:\nCDI:    %+v\nlegacy: %+v", expected, got)
+	}
+
+	// Containers with the same devices share a directory, others get their own
+	chardevDir := func(resp *pluginapi.ContainerAllocateResponse) string {
+		for _, m := range resp.Mounts {
+			if m.ContainerPath == cdi.ChardevClassPath {
+				return m.HostPath
+			}
+		}
+		return ""
+	}
+	if again := allocate("hailo0", "hailo2"); chardevDir(again) != chardevDir(container) {
+		t.Error("Expected the same device set to reuse its chardev directory")
+	}
+	if other := allocate("hailo1"); chardevDir(other) == chardevDir(container) {
+		t.Error("Expected another device set to get its own chardev directory")
+	}
+}
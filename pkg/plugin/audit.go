@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// AllocationAudit is the structured record logged for every Allocate container
+// request. Records are written once the whole request was decided, a failing
+// container rejects all containers of the request.
+type AllocationAudit struct {
+	Time     time.Time      `json:"time"`
+	Resource string         `json:"resource,omitempty"`
+	Mode     AllocationMode `json:"mode"`
+	Devices  []string       `json:"devices"`
+	Result   string         `json:"result"`
+	Code     string         `json:"code,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+}
+
+const (
+	auditResultGranted  = "granted"
+	auditResultRejected = "rejected"
+)
+
+// logAudit writes the record as a single JSON line so it can be picked out of the plugin log
+func logAudit(record AllocationAudit) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode allocation audit record: %v", err)
+		return
+	}
+	log.Printf("allocation-audit %s", data)
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir holds the token and CA the pod uses to reach the API server
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// NodeKubeletVersion reads status.nodeInfo.kubeletVersion of a node from the
+// API server, using the pod's service account. The downward API cannot expose
+// this field, so the plugin needs permission to get its node.
+func NodeKubeletVersion(ctx context.Context, nodeName string) (string, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return "", fmt.Errorf("not running in a cluster, KUBERNETES_SERVICE_HOST is not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return "", fmt.Errorf("no certificate found in the service account CA")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return nodeKubeletVersion(ctx, client, "https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)), nodeName)
+}
+
+// nodeKubeletVersion gets the node object from baseURL and returns its kubelet version
+func nodeKubeletVersion(ctx context.Context, client *http.Client, baseURL, token, nodeName string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v1/nodes/"+url.PathEscape(nodeName), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to get node %s: %s: %s", nodeName, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var node struct {
+		Status struct {
+			NodeInfo struct {
+				KubeletVersion string `json:"kubeletVersion"`
+			} `json:"nodeInfo"`
+		} `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+		return "", fmt.Errorf("failed to decode node %s: %w", nodeName, err)
+	}
+	if node.Status.NodeInfo.KubeletVersion == "" {
+		return "", fmt.Errorf("node %s reports no kubelet version", nodeName)
+	}
+	return node.Status.NodeInfo.KubeletVersion, nil
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNodeKubeletVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/nodes/node-1":
+			w.Write([]byte(`{"kind":"Node","status":{"nodeInfo":{"kubeletVersion":"v1.30.2+k3s1"}}}`))
+		case "/api/v1/nodes/old":
+			w.Write([]byte(`{"kind":"Node","status":{}}`))
+		default:
+			http.Error(w, `nodes "x" not found`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	version, err := nodeKubeletVersion(ctx, server.Client(), server.URL, "secret", "node-1")
+	if err != nil || version != "v1.30.2+k3s1" {
+		t.Errorf("Expected v1.30.2+k3s1, got %q, %v", version, err)
+	}
+	if ResolveAllocationMode(AllocationModeAuto, version) != AllocationModeCDIDevices {
+		t.Error("Expected the detected version to resolve auto to cdi-devices")
+	}
+
+	for _, tc := range []struct{ node, token, message string }{
+		{"missing", "secret", "404"},
+		{"node-1", "wrong", "401"},
+		{"old", "secret", "no kubelet version"},
+	} {
+		if _, err := nodeKubeletVersion(ctx, server.Client(), server.URL, tc.token, tc.node); err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("Node %s with token %s: expected error containing %q, got %v", tc.node, tc.token, tc.message, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"hailo-device-plugin/pkg/hook"
+)
+
+// DefaultLegacyChardevRoot holds the chardev directories bound by the legacy allocation mode
+const DefaultLegacyChardevRoot = hook.DefaultRoot + "/legacy-chardev"
+
+const (
+	// legacyChardevTmpPrefix starts directories still being built
+	legacyChardevTmpPrefix = ".tmp-"
+	// legacyChardevTmpAge is when an unfinished directory is considered abandoned
+	legacyChardevTmpAge = time.Minute
+)
+
+// legacyChardevDir returns a host directory holding copies of the
+// /sys/class/hailo_chardev symlinks of the named devices only. Kubelet can
+// only bind host paths, so it is bound over the class directory in place of
+// the private tmpfs a CDI runtime mounts. The relative symlinks resolve in the
+// container's own sysfs, which gives the same view as the per-device binds.
+//
+// Directories are named after their content and never modified, so
+// containers sharing a device set share a directory and a renumbered device
+// gets a new one.
+func legacyChardevDir(root, sysfsRoot string, names []string) (string, error) {
+	classDir := filepath.Join(sysfsRoot, "class", "hailo_chardev")
+
+	links := make(map[string]string, len(names))
+	for _, name := range names {
+		target, err := os.Readlink(filepath.Join(classDir, name))
+		if err != nil {
+			// The CDI spec leaves such devices without a sysfs entry as well
+			log.Printf("Warning: no sysfs entry for %s in legacy allocation: %v", name, err)
+			continue
+		}
+		links[name] = target
+	}
+
+	sorted := make([]string, 0, len(links))
+	for name := range links {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	sum := sha256.New()
+	for _, name := range sorted {
+		fmt.Fprintf(sum, "%s\x00%s\x00", name, links[name])
+	}
+	dir := filepath.Join(root, hex.EncodeToString(sum.Sum(nil))[:16])
+
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", root, err)
+	}
+
+	// Build the directory aside and rename it, so a concurrent allocation
+	// never binds a partial one
+	tmp, err := os.MkdirTemp(root, legacyChardevTmpPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create chardev directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return "", err
+	}
+	for _, name := range sorted {
+		if err := os.Symlink(links[name], filepath.Join(tmp, name)); err != nil {
+			return "", fmt.Errorf("failed to link %s: %w", name, err)
+		}
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another allocation of the same set won the race
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return dir, nil
+		}
+		return "", fmt.Errorf("failed to create chardev directory: %w", err)
+	}
+	return dir, nil
+}
+
+// collectLegacyChardevDirs removes the chardev directories none of whose
+// entries matches the current sysfs, and abandoned unfinished ones. A
+// directory still naming a current device may be bound by a running
+// container, so it is kept until all of its devices are gone or renumbered.
+func collectLegacyChardevDirs(root, sysfsRoot string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		// Nothing was allocated in legacy mode yet
+		return
+	}
+	classDir := filepath.Join(sysfsRoot, "class", "hailo_chardev")
+
+	for _, entry := range entries {
+		dir := filepath.Join(root, entry.Name())
+		if strings.HasPrefix(entry.Name(), legacyChardevTmpPrefix) {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < legacyChardevTmpAge {
+				continue
+			}
+		} else if hasCurrentChardev(dir, classDir) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Warning: failed to remove legacy chardev directory %s: %v", dir, err)
+			continue
+		}
+		log.Printf("Removed stale legacy chardev directory %s", dir)
+	}
+}
+
+// hasCurrentChardev reports whether any entry of dir still links where the
+// sysfs class entry of the same name does
+func hasCurrentChardev(dir, classDir string) bool {
+	links, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, link := range links {
+		target, err := os.Readlink(filepath.Join(dir, link.Name()))
+		if err != nil {
+			continue
+		}
+		if current, err := os.Readlink(filepath.Join(classDir, link.Name())); err == nil && current == target {
+			return true
+		}
+	}
+	return false
+}
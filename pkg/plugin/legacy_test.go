@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectLegacyChardevDirs(t *testing.T) {
+	sysfsRoot := newFakeChardevSysfs(t, "hailo0", "hailo1")
+	root := t.TempDir()
+
+	pair, err := legacyChardevDir(root, sysfsRoot, []string{"hailo0", "hailo1"})
+	if err != nil {
+		t.Fatalf("legacyChardevDir failed: %v", err)
+	}
+	single, err := legacyChardevDir(root, sysfsRoot, []string{"hailo1"})
+	if err != nil {
+		t.Fatalf("legacyChardevDir failed: %v", err)
+	}
+	abandoned := filepath.Join(root, legacyChardevTmpPrefix+"abandoned")
+	building := filepath.Join(root, legacyChardevTmpPrefix+"building")
+	for _, dir := range []string{abandoned, building} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * legacyChardevTmpAge)
+	if err := os.Chtimes(abandoned, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// hailo1 is renumbered onto another PCI function
+	link := filepath.Join(sysfsRoot, "class", "hailo_chardev", "hailo1")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/pci0000:00/0000:09:00.0/hailo_chardev/hailo1", link); err != nil {
+		t.Fatal(err)
+	}
+
+	collectLegacyChardevDirs(root, sysfsRoot)
+
+	exists := func(dir string) bool {
+		_, err := os.Stat(dir)
+		return err == nil
+	}
+	// A container may still use hailo0 through the pair directory
+	if !exists(pair) {
+		t.Error("Expected the directory naming a current device to be kept")
+	}
+	if exists(single) {
+		t.Error("Expected the directory of the renumbered device to be removed")
+	}
+	if exists(abandoned) {
+		t.Error("Expected the abandoned unfinished directory to be removed")
+	}
+	if !exists(building) {
+		t.Error("Expected a directory still being built to be kept")
+	}
+
+	// Without any legacy allocation there is nothing to collect
+	collectLegacyChardevDirs(filepath.Join(root, "missing"), sysfsRoot)
+}
@@ -2,48 +2,136 @@ package plugin
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
+// DefaultSpecRescanInterval is how often the CDI spec is re-read without a monitor
+const DefaultSpecRescanInterval = 30 * time.Second
+
+// DeviceSource provides the device inventory advertised to kubelet
+type DeviceSource interface {
+	// Subscribe delivers the current snapshot and every later change
+	Subscribe() (<-chan monitor.Snapshot, func())
+	// Latest returns the most recent snapshot, if one was published
+	Latest() (monitor.Snapshot, bool)
+}
+
+var (
+	_ DeviceSource = (*monitor.ResourceMonitor)(nil)
+	_ DeviceSource = (*monitor.Broadcaster)(nil)
+)
+
 type HailoDevicePlugin struct {
-	CdiDir       string
-	SocketPath   string
-	ResourceName string
+	// Monitor pushes device set changes into open ListAndWatch streams.
+	// Without it the plugin falls back to the devices listed in the CDI spec.
+	Monitor DeviceSource
+	CdiDir  string
+	// SpecDirs are read in increasing priority without a monitor, defaults to CdiDir
+	SpecDirs []string
+	// SpecRescanInterval is how often SpecDirs are re-read without a monitor,
+	// zero uses DefaultSpecRescanInterval
+	SpecRescanInterval time.Duration
+	SocketPath         string
+	ResourceName       string
+	// Registration sets the kubelet socket and timeouts, zero values use the defaults
+	Registration Registration
+	// AllocationMode is a resolved mode (not auto), empty means both
+	AllocationMode AllocationMode
+	// Generator renders the spec translated by the legacy mode, nil uses the defaults
+	Generator *cdi.Generator
+	// LegacyChardevRoot holds the chardev directories of the legacy mode,
+	// empty uses DefaultLegacyChardevRoot
+	LegacyChardevRoot string
+	// Replicas advertises each device as several time-sliced virtual devices,
+	// or as shared slots with Service
+	Replicas Replicas
+	// Service hands out hailort_service access instead of device nodes, optional
+	Service *HailortService
 }
 
 var _ pluginapi.DevicePluginServer = (*HailoDevicePlugin)(nil)
 
 func (p *HailoDevicePlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	return &pluginapi.DevicePluginOptions{}, nil
+	return &pluginapi.DevicePluginOptions{
+		GetPreferredAllocationAvailable: true,
+	}, nil
 }
 
 func (p *HailoDevicePlugin) ListAndWatch(_ *pluginapi.Empty, server pluginapi.DevicePlugin_ListAndWatchServer) error {
-	log.Printf("ListAndWatch called, reading devices from CDI dir: %s", p.CdiDir)
+	if p.Monitor == nil {
+		return p.listAndWatchCDI(server)
+	}
+
+	log.Println("ListAndWatch called, subscribing to device updates")
+	updates, unsubscribe := p.Monitor.Subscribe()
+	defer unsubscribe()
 
-	// Send initial device list
-	if err := p.sendDeviceList(server); err != nil {
+	// The broadcaster only delivers actual changes, so every snapshot is sent
+	for {
+		select {
+		case snap := <-updates:
+			log.Printf("Device set generation %d received", snap.Generation)
+			p.collectLegacyChardev()
+			if err := p.sendDeviceList(server, snapshotDevices(snap, p.Replicas)); err != nil {
+				return err
+			}
+		case <-server.Context().Done():
+			log.Println("ListAndWatch stream closed")
+			return server.Context().Err()
+		}
+	}
+}
+
+// listAndWatchCDI reports the devices of the CDI spec and re-reads it
+// periodically, sending the list again whenever it changed. A spec that
+// cannot be read keeps the last list.
+func (p *HailoDevicePlugin) listAndWatchCDI(server pluginapi.DevicePlugin_ListAndWatchServer) error {
+	log.Printf("ListAndWatch called without monitor, reading devices from CDI dirs: %v", p.specDirs())
+
+	devices, err := p.cdiDevices()
+	if err != nil {
+		log.Printf("Failed to read devices from CDI: %v", err)
+		devices = []*pluginapi.Device{}
+	}
+	p.collectLegacyChardev()
+	if err := p.sendDeviceList(server, devices); err != nil {
 		return err
 	}
 
-	// Keep the stream alive and periodically check for device changes
-	ticker := time.NewTicker(30 * time.Second)
+	interval := p.SpecRescanInterval
+	if interval <= 0 {
+		interval = DefaultSpecRescanInterval
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			log.Println("Periodic device list update")
-			if err := p.sendDeviceList(server); err != nil {
-				log.Printf("Failed to send periodic device list update: %v", err)
+			current, err := p.cdiDevices()
+			if err != nil {
+				log.Printf("Failed to read devices from CDI, keeping the last list: %v", err)
+				continue
+			}
+			if sameDevices(devices, current) {
+				continue
+			}
+			log.Println("CDI spec devices changed")
+			p.collectLegacyChardev()
+			if err := p.sendDeviceList(server, current); err != nil {
 				return err
 			}
+			devices = current
 		case <-server.Context().Done():
 			log.Println("ListAndWatch stream closed")
 			return server.Context().Err()
@@ -51,30 +139,77 @@ func (p *HailoDevicePlugin) ListAndWatch(_ *pluginapi.Empty, server pluginapi.De
 	}
 }
 
-func (p *HailoDevicePlugin) sendDeviceList(server pluginapi.DevicePlugin_ListAndWatchServer) error {
-	// Read devices from CDI
-	devices, err := cdi.ReadDevices(p.CdiDir)
-	if err != nil {
-		log.Printf("Failed to read devices from CDI: %v", err)
-		// Fallback to empty list or handle error
-		devices = []string{}
+// sameDevices reports whether two device lists have the same IDs and health in order
+func sameDevices(a, b []*pluginapi.Device) bool {
+	if len(a) != len(b) {
+		return false
 	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Health != b[i].Health {
+			return false
+		}
+	}
+	return true
+}
 
-	log.Printf("Found %d devices from CDI: %v", len(devices), devices)
+// snapshotDevices converts a monitor snapshot into kubelet devices, one per
+// replica of each device
+func snapshotDevices(snap monitor.Snapshot, replicas Replicas) []*pluginapi.Device {
+	devices := make([]*pluginapi.Device, 0, len(snap.Devices))
+	for _, d := range snap.Devices {
+		health := pluginapi.Healthy
+		if !d.Healthy {
+			health = pluginapi.Unhealthy
+			log.Printf("Device %s reported unhealthy: %s", d.Name, d.Reason)
+		}
+		for _, id := range replicas.IDs(d.Device) {
+			devices = append(devices, &pluginapi.Device{
+				ID:       id,
+				Health:   health,
+				Topology: topologyInfo(d.Device),
+			})
+		}
+	}
+	return devices
+}
+
+// topologyInfo reports the device's NUMA node so Topology Manager can align
+// it with the pod's CPUs and memory, nil when the node is unknown
+func topologyInfo(d device.Device) *pluginapi.TopologyInfo {
+	if d.NUMANode < 0 {
+		return nil
+	}
+	return &pluginapi.TopologyInfo{
+		Nodes: []*pluginapi.NUMANode{{ID: int64(d.NUMANode)}},
+	}
+}
+
+// cdiDevices reads the device names from the CDI spec and reports them healthy
+func (p *HailoDevicePlugin) cdiDevices() ([]*pluginapi.Device, error) {
+	names, err := cdi.ReadDevices(p.specDirs()...)
+	if err != nil {
+		return nil, err
+	}
 
-	var pluginDevices []*pluginapi.Device
-	for _, id := range devices {
-		device := &pluginapi.Device{
-			ID:     id,
-			Health: pluginapi.Healthy,
+	devices := make([]*pluginapi.Device, 0, len(names))
+	for _, name := range names {
+		for _, id := range p.Replicas.IDs(device.New(name)) {
+			devices = append(devices, &pluginapi.Device{
+				ID:     id,
+				Health: pluginapi.Healthy,
+			})
 		}
-		pluginDevices = append(pluginDevices, device)
-		log.Printf("Added device: ID=%s, Health=%s", device.ID, device.Health)
 	}
+	return devices, nil
+}
 
-	log.Printf("Sending %d devices to kubelet: %v", len(pluginDevices), pluginDevices)
+func (p *HailoDevicePlugin) sendDeviceList(server pluginapi.DevicePlugin_ListAndWatchServer, devices []*pluginapi.Device) error {
+	for _, device := range devices {
+		log.Printf("Device: ID=%s, Health=%s", device.ID, device.Health)
+	}
+	log.Printf("Sending %d devices to kubelet", len(devices))
 
-	response := &pluginapi.ListAndWatchResponse{Devices: pluginDevices}
+	response := &pluginapi.ListAndWatchResponse{Devices: devices}
 
 	if err := server.Send(response); err != nil {
 		log.Printf("Failed to send device list: %v", err)
@@ -88,40 +223,199 @@ func (p *HailoDevicePlugin) sendDeviceList(server pluginapi.DevicePlugin_ListAnd
 func (p *HailoDevicePlugin) Allocate(ctx context.Context, req *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
 	log.Printf("Allocate called with request: %v", req)
 
+	mode := p.AllocationMode
+	if mode == "" {
+		mode = AllocationModeBoth
+	}
+
 	var response pluginapi.AllocateResponse
+	states := p.deviceStates()
+	warnSharedReplicas(p.ResourceName, req.ContainerRequests)
+
+	// Kubelet gets all containers or none, so grants are only logged once every container succeeded
+	audit := func(ids []string, result string, err error) {
+		record := AllocationAudit{
+			Time:     time.Now().UTC(),
+			Resource: p.ResourceName,
+			Mode:     mode,
+			Devices:  ids,
+			Result:   result,
+		}
+		if err != nil {
+			st := status.Convert(err)
+			record.Code = st.Code().String()
+			record.Reason = st.Message()
+		}
+		logAudit(record)
+	}
 
 	for _, containerReq := range req.ContainerRequests {
 		log.Printf("Processing container request for %d devices: %v", len(containerReq.DevicesIDs), containerReq.DevicesIDs)
 
-		// Build CDI device names for requested devices
-		var cdiDevices []string
-		for _, deviceID := range containerReq.DevicesIDs {
-			// CDI device name format: hailo.ai/npu=<device-name>
-			cdiDeviceName := fmt.Sprintf("hailo.ai/npu=%s", deviceID)
-			cdiDevices = append(cdiDevices, cdiDeviceName)
-		}
-
-		containerResponse := &pluginapi.ContainerAllocateResponse{
-			// Use CDI device names in annotations
-			Annotations: map[string]string{
-				"cdi.k8s.io/hailo": strings.Join(cdiDevices, ","),
-			},
+		containerResponse, err := p.containerResponse(mode, states, containerReq.DevicesIDs)
+		if err != nil {
+			for _, r := range req.ContainerRequests {
+				audit(r.DevicesIDs, auditResultRejected, err)
+			}
+			return nil, err
 		}
-
-		log.Printf("Allocated CDI devices: %v", cdiDevices)
 		response.ContainerResponses = append(response.ContainerResponses, containerResponse)
 	}
 
+	for _, containerReq := range req.ContainerRequests {
+		audit(containerReq.DevicesIDs, auditResultGranted, nil)
+	}
+
 	log.Printf("Allocation response: %v", response)
 	return &response, nil
 }
 
+// containerResponse validates ids against the current inventory and builds the response for mode
+func (p *HailoDevicePlugin) containerResponse(mode AllocationMode, states map[string]monitor.DeviceState, ids []string) (*pluginapi.ContainerAllocateResponse, error) {
+	if err := validateDevices(states, ids); err != nil {
+		return nil, err
+	}
+
+	// Replicas of one device share its CDI device
+	devices := physicalDevices(states, ids)
+
+	generator := p.generator()
+
+	var response *pluginapi.ContainerAllocateResponse
+	if p.Service != nil {
+		response = p.Service.containerResponse()
+	} else if mode == AllocationModeLegacy {
+		var err error
+		if response, err = legacyContainerResponse(generator, devices, p.legacyChardevRoot()); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if response, err = cdiContainerResponse(mode, device.Names(devices)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Global env and the combined device list depend on the allocation, which
+	// a static CDI spec cannot describe, so every mode passes them here
+	global, err := generator.Env.RenderGlobal(devices)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to render global env: %v", err)
+	}
+	if response.Envs == nil {
+		response.Envs = make(map[string]string)
+	}
+	for _, env := range global {
+		key, value, _ := strings.Cut(env, "=")
+		response.Envs[key] = value
+	}
+	response.Envs[visibleDevicesEnv] = cdi.VisibleDevices(devices)
+	return response, nil
+}
+
+// generator returns the configured CDI generator or one with the defaults
+func (p *HailoDevicePlugin) generator() *cdi.Generator {
+	if p.Generator == nil {
+		return cdi.NewGenerator("", "")
+	}
+	return p.Generator
+}
+
+// legacyChardevRoot returns LegacyChardevRoot or its default
+func (p *HailoDevicePlugin) legacyChardevRoot() string {
+	if p.LegacyChardevRoot == "" {
+		return DefaultLegacyChardevRoot
+	}
+	return p.LegacyChardevRoot
+}
+
+// collectLegacyChardev removes stale legacy chardev directories when the
+// device set changed, see collectLegacyChardevDirs
+func (p *HailoDevicePlugin) collectLegacyChardev() {
+	if p.AllocationMode == AllocationModeLegacy {
+		collectLegacyChardevDirs(p.legacyChardevRoot(), p.generator().SysfsRoot)
+	}
+}
+
 func (p *HailoDevicePlugin) PreStartContainer(context.Context, *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
 	// Optional: Implement pre-start logic if needed
 	return &pluginapi.PreStartContainerResponse{}, nil
 }
 
-func (p *HailoDevicePlugin) GetPreferredAllocation(context.Context, *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	// Optional: Implement preferred allocation logic if needed
-	return &pluginapi.PreferredAllocationResponse{}, nil
+func (p *HailoDevicePlugin) GetPreferredAllocation(ctx context.Context, req *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	inventory := p.inventory()
+
+	var response pluginapi.PreferredAllocationResponse
+	for _, containerReq := range req.ContainerRequests {
+		preferred := preferredDevices(inventory,
+			containerReq.AvailableDeviceIDs,
+			containerReq.MustIncludeDeviceIDs,
+			int(containerReq.AllocationSize))
+
+		log.Printf("Preferred allocation of %d from %v (must include %v): %v",
+			containerReq.AllocationSize, containerReq.AvailableDeviceIDs, containerReq.MustIncludeDeviceIDs, preferred)
+
+		response.ContainerResponses = append(response.ContainerResponses,
+			&pluginapi.ContainerPreferredAllocationResponse{DeviceIDs: preferred})
+	}
+
+	return &response, nil
+}
+
+// specDirs returns the CDI spec directories in increasing priority
+func (p *HailoDevicePlugin) specDirs() []string {
+	if len(p.SpecDirs) > 0 {
+		return p.SpecDirs
+	}
+	return []string{p.CdiDir}
+}
+
+// deviceStates returns the latest known devices and their health keyed by
+// every advertised ID, replicas included. Without a monitor the devices of
+// the CDI spec are assumed healthy.
+func (p *HailoDevicePlugin) deviceStates() map[string]monitor.DeviceState {
+	states := make(map[string]monitor.DeviceState)
+	if p.Monitor == nil {
+		names, err := cdi.ReadDevices(p.specDirs()...)
+		if err != nil {
+			log.Printf("Failed to read devices from CDI: %v", err)
+		}
+		for _, name := range names {
+			dev := device.New(name)
+			for _, id := range p.Replicas.IDs(dev) {
+				states[id] = monitor.DeviceState{Device: dev, Healthy: true}
+			}
+		}
+		return states
+	}
+
+	snap, ok := p.Monitor.Latest()
+	if !ok {
+		return states
+	}
+	for _, d := range snap.Devices {
+		for _, id := range p.Replicas.IDs(d.Device) {
+			states[id] = d
+		}
+	}
+	return states
+}
+
+// inventory returns the latest known devices keyed by every advertised ID
+func (p *HailoDevicePlugin) inventory() map[string]device.Device {
+	devices := make(map[string]device.Device)
+	if p.Monitor == nil {
+		return devices
+	}
+
+	snap, ok := p.Monitor.Latest()
+	if !ok {
+		return devices
+	}
+	for _, d := range snap.Devices {
+		for _, id := range p.Replicas.IDs(d.Device) {
+			devices[id] = d.Device
+		}
+	}
+	return devices
 }
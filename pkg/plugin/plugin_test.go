@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// fakeListAndWatchServer records the device lists sent by ListAndWatch
+type fakeListAndWatchServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pluginapi.ListAndWatchResponse
+}
+
+func newFakeListAndWatchServer(ctx context.Context) *fakeListAndWatchServer {
+	return &fakeListAndWatchServer{
+		ctx:  ctx,
+		sent: make(chan *pluginapi.ListAndWatchResponse, 10),
+	}
+}
+
+func (f *fakeListAndWatchServer) Send(resp *pluginapi.ListAndWatchResponse) error {
+	f.sent <- resp
+	return nil
+}
+
+func (f *fakeListAndWatchServer) Context() context.Context {
+	return f.ctx
+}
+
+// expectDevices waits for the next response and checks its device IDs and health
+func (f *fakeListAndWatchServer) expectDevices(t *testing.T, expected map[string]string) {
+	t.Helper()
+	select {
+	case resp := <-f.sent:
+		if len(resp.Devices) != len(expected) {
+			t.Fatalf("Expected %d devices, got %v", len(expected), resp.Devices)
+		}
+		for _, d := range resp.Devices {
+			if expected[d.ID] != d.Health {
+				t.Errorf("Device %s: expected health %q, got %q", d.ID, expected[d.ID], d.Health)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for device list")
+	}
+}
+
+func deviceStates(names ...string) []monitor.DeviceState {
+	states := make([]monitor.DeviceState, 0, len(names))
+	for _, name := range names {
+		states = append(states, monitor.DeviceState{Device: device.New(name), Healthy: true})
+	}
+	return states
+}
+
+func TestListAndWatch_PushesUpdatesToAllStreams(t *testing.T) {
+	updates := monitor.NewBroadcaster()
+	updates.Publish(deviceStates("hailo0"))
+
+	plugin := &HailoDevicePlugin{Monitor: updates, ResourceName: "hailo.ai/npu"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	streams := []*fakeListAndWatchServer{newFakeListAndWatchServer(ctx), newFakeListAndWatchServer(ctx)}
+	for _, stream := range streams {
+		go plugin.ListAndWatch(&pluginapi.Empty{}, stream)
+	}
+
+	for _, stream := range streams {
+		stream.expectDevices(t, map[string]string{"hailo0": pluginapi.Healthy})
+	}
+
+	changed := deviceStates("hailo0", "hailo1")
+	changed[0].Healthy = false
+	updates.Publish(changed)
+
+	for _, stream := range streams {
+		stream.expectDevices(t, map[string]string{"hailo0": pluginapi.Unhealthy, "hailo1": pluginapi.Healthy})
+	}
+
+	// Republishing the same set must not resend anything
+	updates.Publish(changed)
+	for i, stream := range streams {
+		select {
+		case resp := <-stream.sent:
+			t.Errorf("Stream %d got unexpected resend: %v", i, resp.Devices)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestListAndWatch_StreamClose(t *testing.T) {
+	plugin := &HailoDevicePlugin{Monitor: monitor.NewBroadcaster()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- plugin.ListAndWatch(&pluginapi.Empty{}, newFakeListAndWatchServer(ctx))
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ListAndWatch did not return after stream close")
+	}
+}
+
+func TestListAndWatch_RereadsCDISpec(t *testing.T) {
+	dir := t.TempDir()
+	writeSpec := func(names ...string) {
+		t.Helper()
+		var devices []string
+		for _, name := range names {
+			devices = append(devices, `{"name": "`+name+`", "containerEdits": {"env": ["A=1"]}}`)
+		}
+		spec := `{"cdiVersion": "0.5.0", "kind": "hailo.ai/npu", "devices": [` + strings.Join(devices, ",") + `]}`
+		// Replace the spec atomically like the monitor does
+		tmp := filepath.Join(dir, ".hailo.json.tmp")
+		if err := os.WriteFile(tmp, []byte(spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "hailo.json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSpec("hailo0")
+
+	plugin := &HailoDevicePlugin{CdiDir: dir, SpecRescanInterval: 20 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeListAndWatchServer(ctx)
+	go plugin.ListAndWatch(&pluginapi.Empty{}, stream)
+
+	stream.expectDevices(t, map[string]string{"hailo0": pluginapi.Healthy})
+
+	// An unchanged spec is not resent
+	select {
+	case resp := <-stream.sent:
+		t.Fatalf("Unexpected resend of an unchanged spec: %v", resp.Devices)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeSpec("hailo0", "hailo1")
+	stream.expectDevices(t, map[string]string{"hailo0": pluginapi.Healthy, "hailo1": pluginapi.Healthy})
+}
+
+func TestListAndWatch_TopologyInfo(t *testing.T) {
+	local := monitor.DeviceState{Device: device.New("hailo0"), Healthy: true}
+	local.NUMANode = 1
+	unknown := monitor.DeviceState{Device: device.New("hailo1"), Healthy: true}
+
+	updates := monitor.NewBroadcaster()
+	updates.Publish([]monitor.DeviceState{local, unknown})
+	plugin := &HailoDevicePlugin{Monitor: updates}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeListAndWatchServer(ctx)
+	go plugin.ListAndWatch(&pluginapi.Empty{}, stream)
+
+	select {
+	case resp := <-stream.sent:
+		for _, d := range resp.Devices {
+			switch d.ID {
+			case "hailo0":
+				if d.Topology == nil || len(d.Topology.Nodes) != 1 || d.Topology.Nodes[0].ID != 1 {
+					t.Errorf("Expected NUMA node 1 for hailo0, got %v", d.Topology)
+				}
+			case "hailo1":
+				if d.Topology != nil {
+					t.Errorf("Expected no topology for hailo1, got %v", d.Topology)
+				}
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for device list")
+	}
+}
@@ -13,16 +13,46 @@ import (
 )
 
 const (
-	kubeletEndpoint = "/var/lib/kubelet/device-plugins/kubelet.sock"
+	// DefaultKubeletSocket is kubelet's device plugin registration socket
+	DefaultKubeletSocket = "/var/lib/kubelet/device-plugins/kubelet.sock"
+	// DefaultRegisterTimeout bounds connecting to kubelet and the Register call
+	DefaultRegisterTimeout = 10 * time.Second
+	// DefaultRegisterBackoff is multiplied by the attempt number between attempts
+	DefaultRegisterBackoff = 2 * time.Second
 )
 
+// Registration controls how a plugin registers with kubelet
+type Registration struct {
+	// KubeletSocket is kubelet's registration socket
+	KubeletSocket string
+	// Timeout bounds connecting and the Register call of one attempt
+	Timeout time.Duration
+	// Backoff is multiplied by the attempt number between attempts
+	Backoff time.Duration
+}
+
+// withDefaults fills in the default of every unset field
+func (r Registration) withDefaults() Registration {
+	if r.KubeletSocket == "" {
+		r.KubeletSocket = DefaultKubeletSocket
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DefaultRegisterTimeout
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = DefaultRegisterBackoff
+	}
+	return r
+}
+
 // RegisterWithKubelet registers the device plugin with kubelet
-// Returns error if registration fails after retries
-func RegisterWithKubelet(plugin *HailoDevicePlugin, maxRetries int) error {
+// Returns error if registration fails after retries or ctx is cancelled
+func RegisterWithKubelet(ctx context.Context, plugin *HailoDevicePlugin, maxRetries int) error {
 	var lastErr error
+	backoff := plugin.Registration.withDefaults().Backoff
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		err := registerOnce(plugin)
+		err := registerOnce(ctx, plugin)
 		if err == nil {
 			log.Println("Device plugin registered successfully with kubelet")
 			return nil
@@ -33,9 +63,13 @@ func RegisterWithKubelet(plugin *HailoDevicePlugin, maxRetries int) error {
 
 		if attempt < maxRetries {
 			// Wait before retrying (exponential backoff)
-			backoff := time.Duration(attempt) * 2 * time.Second
-			log.Printf("Retrying in %v...", backoff)
-			time.Sleep(backoff)
+			wait := time.Duration(attempt) * backoff
+			log.Printf("Retrying in %v...", wait)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return fmt.Errorf("registration cancelled: %w", ctx.Err())
+			}
 		}
 	}
 
@@ -43,7 +77,10 @@ func RegisterWithKubelet(plugin *HailoDevicePlugin, maxRetries int) error {
 }
 
 // registerOnce attempts a single registration with kubelet
-func registerOnce(plugin *HailoDevicePlugin) error {
+func registerOnce(parent context.Context, plugin *HailoDevicePlugin) error {
+	registration := plugin.Registration.withDefaults()
+	kubeletEndpoint := registration.KubeletSocket
+
 	// Check if kubelet socket exists
 	log.Printf("Checking kubelet socket at: %s", kubeletEndpoint)
 	if _, err := os.Stat(kubeletEndpoint); os.IsNotExist(err) {
@@ -52,7 +89,7 @@ func registerOnce(plugin *HailoDevicePlugin) error {
 	log.Println("Kubelet socket found, attempting to connect...")
 
 	// Connect to kubelet with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(parent, registration.Timeout)
 	defer cancel()
 
 	conn, err := grpc.DialContext(ctx, "unix://"+kubeletEndpoint,
@@ -77,7 +114,7 @@ func registerOnce(plugin *HailoDevicePlugin) error {
 		req.Version, req.Endpoint, req.ResourceName)
 
 	// Send registration request with timeout
-	regCtx, regCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	regCtx, regCancel := context.WithTimeout(parent, registration.Timeout)
 	defer regCancel()
 
 	_, err = client.Register(regCtx, req)
@@ -61,12 +61,22 @@ func setupMockKubelet(t *testing.T, shouldFail bool) (string, *mockRegistrationS
 
 func TestRegisterWithKubelet_Success(t *testing.T) {
 	// Setup mock kubelet
-	_, _, cleanup := setupMockKubelet(t, false)
+	socketPath, mock, cleanup := setupMockKubelet(t, false)
 	defer cleanup()
 
-	// Since kubeletEndpoint is const, this test demonstrates the structure
-	// In production, we'd need to make the endpoint configurable
-	t.Skip("Skipping: requires configurable kubelet endpoint")
+	plugin := &HailoDevicePlugin{
+		SocketPath:   "/var/lib/kubelet/device-plugins/hailo.sock",
+		ResourceName: "hailo.ai/npu",
+		Registration: Registration{KubeletSocket: socketPath, Timeout: time.Second},
+	}
+	if err := RegisterWithKubelet(context.Background(), plugin, 1); err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+
+	req := <-mock.registerCalled
+	if req.Endpoint != "hailo.sock" || req.ResourceName != "hailo.ai/npu" || req.Version != pluginapi.Version {
+		t.Errorf("Unexpected registration request: %v", req)
+	}
 }
 
 func TestRegisterWithKubelet_NonexistentSocket(t *testing.T) {
@@ -76,7 +86,7 @@ func TestRegisterWithKubelet_NonexistentSocket(t *testing.T) {
 	}
 
 	// Try to register with non-existent kubelet socket
-	err := RegisterWithKubelet(plugin, 1)
+	err := RegisterWithKubelet(context.Background(), plugin, 1)
 	if err == nil {
 		t.Error("Expected error when kubelet socket doesn't exist")
 	}
@@ -95,7 +105,7 @@ func TestRegisterWithKubelet_Retry(t *testing.T) {
 
 	// Test retry mechanism (will fail but should retry)
 	start := time.Now()
-	err := RegisterWithKubelet(plugin, 3)
+	err := RegisterWithKubelet(context.Background(), plugin, 3)
 	elapsed := time.Since(start)
 
 	// Should fail after retries
@@ -113,6 +123,28 @@ func TestRegisterWithKubelet_Retry(t *testing.T) {
 	t.Logf("Retry test took %v with error: %v", elapsed, err)
 }
 
+func TestRegisterWithKubelet_Cancelled(t *testing.T) {
+	plugin := &HailoDevicePlugin{
+		SocketPath:   "/test/plugin.sock",
+		ResourceName: "test.io/device",
+		Registration: Registration{KubeletSocket: "/nonexistent/kubelet.sock", Backoff: time.Minute},
+	}
+
+	// The backoff between attempts ends as soon as ctx is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := RegisterWithKubelet(ctx, plugin, 3)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Expected an error when registration is cancelled")
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Expected cancellation to end the backoff, took %v", elapsed)
+	}
+}
+
 func TestRegisterOnce_Timeout(t *testing.T) {
 	// Test registration timeout
 	plugin := &HailoDevicePlugin{
@@ -121,7 +153,7 @@ func TestRegisterOnce_Timeout(t *testing.T) {
 	}
 
 	start := time.Now()
-	err := registerOnce(plugin)
+	err := registerOnce(context.Background(), plugin)
 	elapsed := time.Since(start)
 
 	// Should fail quickly (socket doesn't exist)
@@ -156,7 +188,7 @@ func TestRegisterWithKubelet_MaxRetries(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			start := time.Now()
-			err := RegisterWithKubelet(plugin, tc.maxRetries)
+			err := RegisterWithKubelet(context.Background(), plugin, tc.maxRetries)
 			elapsed := time.Since(start)
 
 			if err == nil {
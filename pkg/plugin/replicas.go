@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// replicaSeparator joins a device name and replica index in a virtual device ID
+const replicaSeparator = "::"
+
+// Replicas advertises every physical device as several time-sliced virtual
+// devices, hailo0::0 to hailo0::N-1, so light workloads can share one NPU
+type Replicas struct {
+	// Default applies to devices whose model has no entry, 0 or 1 disables sharing
+	Default int
+	// PerModel overrides Default for the devices of one model
+	PerModel map[string]int
+}
+
+// ParseReplicas parses a comma-separated replica setting where a bare
+// number applies to every device and model=N to one model, e.g. 2,hailo8=4
+func ParseReplicas(spec string) (Replicas, error) {
+	var r Replicas
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		model, value, perModel := strings.Cut(entry, "=")
+		if !perModel {
+			value = model
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return Replicas{}, fmt.Errorf("invalid replica count in %q, expected a positive number", entry)
+		}
+
+		if !perModel {
+			r.Default = n
+			continue
+		}
+		model = device.NormalizeModel(model)
+		if model == "" {
+			return Replicas{}, fmt.Errorf("invalid replica entry %q, expected model=N", entry)
+		}
+		if r.PerModel == nil {
+			r.PerModel = make(map[string]int)
+		}
+		r.PerModel[model] = n
+	}
+	return r, nil
+}
+
+// count returns how many replicas dev is advertised as, at least one
+func (r Replicas) count(dev device.Device) int {
+	n, ok := r.PerModel[dev.Model]
+	if !ok {
+		n = r.Default
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// IDs returns the device IDs dev is advertised as, just its name without sharing
+func (r Replicas) IDs(dev device.Device) []string {
+	n := r.count(dev)
+	if n == 1 {
+		return []string{dev.Name}
+	}
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, ReplicaID(dev.Name, i))
+	}
+	return ids
+}
+
+// ReplicaID returns the virtual device ID of one replica, e.g. hailo0::1
+func ReplicaID(name string, replica int) string {
+	return name + replicaSeparator + strconv.Itoa(replica)
+}
+
+// PhysicalID returns the device name of a virtual device ID, or id itself
+func PhysicalID(id string) string {
+	name, _, _ := strings.Cut(id, replicaSeparator)
+	return name
+}
+
+// physicalDevices maps allocated IDs to their devices, each physical device
+// once and in order of first appearance
+func physicalDevices(states map[string]monitor.DeviceState, ids []string) []device.Device {
+	devices := make([]device.Device, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		d := states[id].Device
+		if !seen[d.Name] {
+			seen[d.Name] = true
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// warnSharedReplicas logs when one pod gets several replicas of the same
+// device, which time-share one NPU instead of adding capacity
+func warnSharedReplicas(resource string, requests []*pluginapi.ContainerAllocateRequest) {
+	replicas := make(map[string][]string)
+	for _, req := range requests {
+		for _, id := range req.DevicesIDs {
+			if name := PhysicalID(id); name != id {
+				replicas[name] = append(replicas[name], id)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(replicas))
+	for name, ids := range replicas {
+		if len(ids) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("Warning: %s allocation got replicas %v of the same device %s, they time-share one NPU",
+			resource, replicas[name], name)
+	}
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestParseReplicas(t *testing.T) {
+	r, err := ParseReplicas("2, Hailo-8=4")
+	if err != nil {
+		t.Fatalf("ParseReplicas failed: %v", err)
+	}
+	expected := Replicas{Default: 2, PerModel: map[string]int{device.ModelHailo8: 4}}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, r)
+	}
+
+	for _, invalid := range []string{"0", "x", "hailo8=", "=2", "hailo8l=-1"} {
+		if _, err := ParseReplicas(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestReplicas_IDs(t *testing.T) {
+	r := Replicas{PerModel: map[string]int{device.ModelHailo8: 2}}
+
+	hailo8 := device.New("hailo0")
+	hailo8.Model = device.ModelHailo8
+	if got := r.IDs(hailo8); !reflect.DeepEqual(got, []string{"hailo0::0", "hailo0::1"}) {
+		t.Errorf("Unexpected replica IDs: %v", got)
+	}
+	// Models without an entry fall back to the unshared default
+	if got := r.IDs(device.New("hailo1")); !reflect.DeepEqual(got, []string{"hailo1"}) {
+		t.Errorf("Unexpected IDs without sharing: %v", got)
+	}
+	if PhysicalID("hailo0::1") != "hailo0" || PhysicalID("hailo1") != "hailo1" {
+		t.Error("PhysicalID did not map IDs back to device names")
+	}
+}
+
+func TestAllocate_ReplicasMapToPhysicalDevices(t *testing.T) {
+	updates := monitor.NewBroadcaster()
+	updates.Publish(deviceStates("hailo0", "hailo1"))
+	plugin := &HailoDevicePlugin{
+		Monitor:        updates,
+		AllocationMode: AllocationModeCDIDevices,
+		Replicas:       Replicas{Default: 4},
+	}
+
+	resp, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{"hailo0::1", "hailo0::3", "hailo1::0"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	container := resp.ContainerResponses[0]
+	var names []string
+	for _, d := range container.CDIDevices {
+		names = append(names, d.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"hailo.ai/npu=hailo0", "hailo.ai/npu=hailo1"}) {
+		t.Errorf("Expected each physical device once, got %v", names)
+	}
+	if got := container.Envs[visibleDevicesEnv]; got != "/dev/hailo0,/dev/hailo1" {
+		t.Errorf("Unexpected %s: %q", visibleDevicesEnv, got)
+	}
+
+	// Neither physical names nor replicas beyond the count are advertised
+	for _, id := range []string{"hailo0", "hailo0::4"} {
+		_, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+			ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{id}}},
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Allocate(%s): expected NotFound, got %v", id, err)
+		}
+	}
+}
+
+func TestListAndWatch_AdvertisesReplicas(t *testing.T) {
+	states := deviceStates("hailo0", "hailo1")
+	states[1].Healthy = false
+	updates := monitor.NewBroadcaster()
+	updates.Publish(states)
+	plugin := &HailoDevicePlugin{Monitor: updates, Replicas: Replicas{Default: 2}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := newFakeListAndWatchServer(ctx)
+	go plugin.ListAndWatch(&pluginapi.Empty{}, server)
+
+	server.expectDevices(t, map[string]string{
+		"hailo0::0": pluginapi.Healthy,
+		"hailo0::1": pluginapi.Healthy,
+		"hailo1::0": pluginapi.Unhealthy,
+		"hailo1::1": pluginapi.Unhealthy,
+	})
+}
+
+func TestPreferredDevices_SpreadsReplicas(t *testing.T) {
+	replicas := Replicas{Default: 2}
+	inventory := make(map[string]device.Device)
+	var available []string
+	for _, d := range twoSwitchInventory() {
+		for _, id := range replicas.IDs(d) {
+			inventory[id] = d
+			available = append(available, id)
+		}
+	}
+
+	got := preferredDevices(inventory, available, nil, 2)
+	if len(got) != 2 || PhysicalID(got[0]) == PhysicalID(got[1]) {
+		t.Errorf("Expected replicas of two different devices, got %v", got)
+	}
+	if PhysicalID(got[0]) != "hailo0" || PhysicalID(got[1]) != "hailo1" {
+		t.Errorf("Expected devices behind one switch, got %v", got)
+	}
+}
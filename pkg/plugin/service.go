@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// DefaultServiceSocket is where hailort_service listens unless configured otherwise
+	DefaultServiceSocket = "/tmp/hailort_uds.sock"
+	// DefaultServiceSlots is the number of shared slots per device without --replicas
+	DefaultServiceSlots = 4
+	// DefaultServiceProbeInterval is how often the service is checked for liveness
+	DefaultServiceProbeInterval = 10 * time.Second
+
+	// serviceAddressEnv points HailoRT in the container at the service
+	serviceAddressEnv = "HAILORT_SERVICE_ADDRESS"
+	// serviceProbeTimeout bounds one connection attempt to the service
+	serviceProbeTimeout = time.Second
+)
+
+// HailortService shares devices through the HailoRT multi-process service.
+// Containers get the service socket instead of device nodes, and the
+// service schedules their networks on the devices.
+type HailortService struct {
+	// Socket is the host path of the service's unix socket
+	Socket string
+	// HostRoot is where the host filesystem is visible to the plugin
+	HostRoot string
+}
+
+// Probe checks that the service accepts connections on its socket
+func (s *HailortService) Probe() error {
+	conn, err := net.DialTimeout("unix", filepath.Join(s.HostRoot, s.Socket), serviceProbeTimeout)
+	if err != nil {
+		return fmt.Errorf("hailort_service is not reachable at %s: %w", s.Socket, err)
+	}
+	return conn.Close()
+}
+
+// containerResponse mounts the service socket and points HailoRT at it
+func (s *HailortService) containerResponse() *pluginapi.ContainerAllocateResponse {
+	return &pluginapi.ContainerAllocateResponse{
+		Mounts: []*pluginapi.Mount{{
+			ContainerPath: s.Socket,
+			HostPath:      s.Socket,
+		}},
+		Envs: map[string]string{
+			serviceAddressEnv: "unix://" + s.Socket,
+		},
+	}
+}
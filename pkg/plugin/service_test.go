@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"hailo-device-plugin/pkg/monitor"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestHailortService_Probe(t *testing.T) {
+	root := t.TempDir()
+	service := &HailortService{Socket: "/hailort_uds.sock", HostRoot: root}
+	if err := service.Probe(); err == nil {
+		t.Error("Expected probe to fail without a listening service")
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(root, "hailort_uds.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	if err := service.Probe(); err != nil {
+		t.Errorf("Expected probe to succeed: %v", err)
+	}
+}
+
+func TestAllocate_ServiceSlots(t *testing.T) {
+	updates := monitor.NewBroadcaster()
+	updates.Publish(deviceStates("hailo0"))
+	plugin := &HailoDevicePlugin{
+		Monitor:        updates,
+		AllocationMode: AllocationModeBoth,
+		Replicas:       Replicas{Default: DefaultServiceSlots},
+		Service:        &HailortService{Socket: DefaultServiceSocket},
+	}
+
+	resp, err := plugin.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"hailo0::2"}}},
+	})
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	container := resp.ContainerResponses[0]
+	if len(container.CDIDevices) != 0 || len(container.Annotations) != 0 || len(container.Devices) != 0 {
+		t.Errorf("Shared slots must not expose device nodes: %v", container)
+	}
+	if len(container.Mounts) != 1 || container.Mounts[0].HostPath != DefaultServiceSocket || container.Mounts[0].ReadOnly {
+		t.Errorf("Expected a writable mount of the service socket, got %v", container.Mounts)
+	}
+	if got := container.Envs[serviceAddressEnv]; got != "unix://"+DefaultServiceSocket {
+		t.Errorf("Unexpected %s: %q", serviceAddressEnv, got)
+	}
+	if got := container.Envs[visibleDevicesEnv]; got != "/dev/hailo0" {
+		t.Errorf("Unexpected %s: %q", visibleDevicesEnv, got)
+	}
+}
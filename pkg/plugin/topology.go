@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"sort"
+
+	"hailo-device-plugin/pkg/device"
+)
+
+const (
+	// sharedBridgeScore is awarded per PCIe bridge two devices sit behind,
+	// so devices under one switch outrank devices that only share a NUMA node
+	sharedBridgeScore = 10
+	// sameNUMAScore is awarded when both devices report the same NUMA node
+	sameNUMAScore = 5
+	// sameDevicePenalty keeps replicas of one device apart, as they
+	// time-share a single NPU instead of adding capacity
+	sameDevicePenalty = 100
+)
+
+// affinity scores how close two devices are on the PCIe and NUMA topology.
+// Two replicas of the same device score below any pair of distinct devices.
+func affinity(a, b device.Device) int {
+	if a.Name == b.Name {
+		return -sameDevicePenalty
+	}
+	score := 0
+	for i := 0; i < len(a.PCIPath) && i < len(b.PCIPath); i++ {
+		if a.PCIPath[i] != b.PCIPath[i] {
+			break
+		}
+		score += sharedBridgeScore
+	}
+	if a.NUMANode >= 0 && a.NUMANode == b.NUMANode {
+		score += sameNUMAScore
+	}
+	return score
+}
+
+// preferredDevices picks size devices out of available, always including
+// mustInclude, so that the chosen set is as close together as possible.
+// Devices missing from inventory are treated as having unknown topology.
+func preferredDevices(inventory map[string]device.Device, available, mustInclude []string, size int) []string {
+	lookup := func(id string) device.Device {
+		if d, ok := inventory[id]; ok {
+			return d
+		}
+		return device.New(id)
+	}
+
+	selected := make([]string, 0, size)
+	taken := make(map[string]bool)
+	for _, id := range mustInclude {
+		if !taken[id] {
+			selected = append(selected, id)
+			taken[id] = true
+		}
+	}
+
+	var candidates []string
+	for _, id := range available {
+		if !taken[id] {
+			candidates = append(candidates, id)
+			taken[id] = true
+		}
+	}
+	sortByIndex(candidates, lookup)
+
+	if len(selected) >= size || len(candidates) == 0 {
+		return selected
+	}
+
+	// With required devices the seed is fixed, otherwise every candidate
+	// is tried as seed and the tightest resulting set wins
+	if len(selected) > 0 {
+		result, _ := growSelection(selected, candidates, size, lookup)
+		return result
+	}
+
+	var best []string
+	bestScore := 0
+	for _, seed := range candidates {
+		rest := make([]string, 0, len(candidates)-1)
+		for _, id := range candidates {
+			if id != seed {
+				rest = append(rest, id)
+			}
+		}
+		result, score := growSelection([]string{seed}, rest, size, lookup)
+		if best == nil || score > bestScore {
+			best, bestScore = result, score
+		}
+	}
+	return best
+}
+
+// growSelection greedily adds the candidate with the highest affinity to the
+// current selection until size is reached, returning the set and its total score
+func growSelection(selected, candidates []string, size int, lookup func(string) device.Device) ([]string, int) {
+	result := append([]string(nil), selected...)
+	remaining := append([]string(nil), candidates...)
+
+	for len(result) < size && len(remaining) > 0 {
+		bestIdx, bestScore := -1, 0
+		for i, id := range remaining {
+			score := 0
+			for _, chosen := range result {
+				score += affinity(lookup(id), lookup(chosen))
+			}
+			// Candidates are sorted, so the first best keeps the lowest index
+			if bestIdx < 0 || score > bestScore {
+				bestIdx, bestScore = i, score
+			}
+		}
+		result = append(result, remaining[bestIdx])
+		remaining = append(remaining[:bestIdx], remaining[bestIdx+1:]...)
+	}
+
+	total := 0
+	for i := range result {
+		for j := i + 1; j < len(result); j++ {
+			total += affinity(lookup(result[i]), lookup(result[j]))
+		}
+	}
+	return result, total
+}
+
+// sortByIndex orders device IDs by their numeric index, then by name
+func sortByIndex(ids []string, lookup func(string) device.Device) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := lookup(ids[i]), lookup(ids[j])
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Name < b.Name
+	})
+}
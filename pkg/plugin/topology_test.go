@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// topologyDevice builds a device with the given NUMA node and bridge chain
+func topologyDevice(name string, numa int, path ...string) device.Device {
+	d := device.New(name)
+	d.NUMANode = numa
+	d.PCIPath = path
+	return d
+}
+
+// twoSwitchInventory models two PCIe switches, each with two NPUs, on two NUMA nodes
+func twoSwitchInventory() map[string]device.Device {
+	devices := []device.Device{
+		topologyDevice("hailo0", 0, "0000:00:01.0", "0000:02:00.0", "0000:03:01.0"),
+		topologyDevice("hailo1", 0, "0000:00:01.0", "0000:02:00.0", "0000:03:02.0"),
+		topologyDevice("hailo2", 1, "0000:80:01.0", "0000:82:00.0", "0000:83:01.0"),
+		topologyDevice("hailo3", 1, "0000:80:01.0", "0000:82:00.0", "0000:83:02.0"),
+	}
+	inventory := make(map[string]device.Device)
+	for _, d := range devices {
+		inventory[d.Name] = d
+	}
+	return inventory
+}
+
+func TestPreferredDevices(t *testing.T) {
+	numaOnly := map[string]device.Device{
+		"hailo0": topologyDevice("hailo0", 0),
+		"hailo1": topologyDevice("hailo1", 1),
+		"hailo2": topologyDevice("hailo2", 0),
+		"hailo3": topologyDevice("hailo3", 1),
+	}
+
+	testCases := []struct {
+		name        string
+		inventory   map[string]device.Device
+		available   []string
+		mustInclude []string
+		size        int
+		expected    []string
+	}{
+		{"same switch first", twoSwitchInventory(), []string{"hailo3", "hailo2", "hailo1", "hailo0"}, nil, 2, []string{"hailo0", "hailo1"}},
+		{"only one full switch left", twoSwitchInventory(), []string{"hailo1", "hailo2", "hailo3"}, nil, 2, []string{"hailo2", "hailo3"}},
+		{"must include picks its switch", twoSwitchInventory(), []string{"hailo0", "hailo1", "hailo2", "hailo3"}, []string{"hailo3"}, 2, []string{"hailo3", "hailo2"}},
+		{"spill over to other switch", twoSwitchInventory(), []string{"hailo0", "hailo1", "hailo2", "hailo3"}, nil, 3, []string{"hailo0", "hailo1", "hailo2"}},
+		{"numa locality without bridges", numaOnly, []string{"hailo0", "hailo1", "hailo2", "hailo3"}, nil, 2, []string{"hailo0", "hailo2"}},
+		{"unknown topology keeps index order", map[string]device.Device{}, []string{"hailo2", "hailo0", "hailo1"}, nil, 2, []string{"hailo0", "hailo1"}},
+		{"size larger than available", twoSwitchInventory(), []string{"hailo1", "hailo0"}, nil, 4, []string{"hailo0", "hailo1"}},
+		{"must include fills the request", twoSwitchInventory(), []string{"hailo0", "hailo2"}, []string{"hailo0", "hailo2"}, 2, []string{"hailo0", "hailo2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := preferredDevices(tc.inventory, tc.available, tc.mustInclude, tc.size)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetPreferredAllocation(t *testing.T) {
+	updates := monitor.NewBroadcaster()
+	var states []monitor.DeviceState
+	for _, name := range []string{"hailo0", "hailo1", "hailo2", "hailo3"} {
+		states = append(states, monitor.DeviceState{Device: twoSwitchInventory()[name], Healthy: true})
+	}
+	updates.Publish(states)
+
+	plugin := &HailoDevicePlugin{Monitor: updates}
+
+	opts, err := plugin.GetDevicePluginOptions(context.Background(), &pluginapi.Empty{})
+	if err != nil || !opts.GetPreferredAllocationAvailable {
+		t.Fatalf("Plugin must advertise GetPreferredAllocation, got %+v (err %v)", opts, err)
+	}
+
+	resp, err := plugin.GetPreferredAllocation(context.Background(), &pluginapi.PreferredAllocationRequest{
+		ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{
+			{AvailableDeviceIDs: []string{"hailo0", "hailo2", "hailo3"}, AllocationSize: 2},
+			{AvailableDeviceIDs: []string{"hailo0", "hailo1", "hailo2"}, MustIncludeDeviceIDs: []string{"hailo1"}, AllocationSize: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetPreferredAllocation failed: %v", err)
+	}
+	if len(resp.ContainerResponses) != 2 {
+		t.Fatalf("Expected 2 container responses, got %d", len(resp.ContainerResponses))
+	}
+	if got := resp.ContainerResponses[0].DeviceIDs; !reflect.DeepEqual(got, []string{"hailo2", "hailo3"}) {
+		t.Errorf("First container: expected [hailo2 hailo3], got %v", got)
+	}
+	if got := resp.ContainerResponses[1].DeviceIDs; !reflect.DeepEqual(got, []string{"hailo1", "hailo0"}) {
+		t.Errorf("Second container: expected [hailo1 hailo0], got %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+package statemachine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"hailo-device-plugin/pkg/plugin"
+)
+
+// registerFunc registers one plugin instance with kubelet, giving up once ctx is cancelled
+type registerFunc func(ctx context.Context, p *plugin.HailoDevicePlugin) error
+
+// ResourceServer serves one plugin instance on its own socket. It is
+// started, registered and restarted independently of the other resources.
+type ResourceServer struct {
+	plugin     *plugin.HailoDevicePlugin
+	server     *plugin.Server
+	registered bool
+}
+
+// NewResourceServer creates a stopped server for a plugin instance
+func NewResourceServer(p *plugin.HailoDevicePlugin) *ResourceServer {
+	return &ResourceServer{plugin: p}
+}
+
+// Name returns the resource name served
+func (r *ResourceServer) Name() string {
+	return r.plugin.ResourceName
+}
+
+// Ready reports whether the server is serving and registered with kubelet
+func (r *ResourceServer) Ready() bool {
+	return r.server != nil && r.registered
+}
+
+// start creates the socket and serves the plugin on it
+func (r *ResourceServer) start() error {
+	server, err := plugin.NewServer(r.plugin, r.plugin.SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	if err := server.Start(); err != nil {
+		server.Stop()
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	r.server = server
+	return nil
+}
+
+// register announces the running server to kubelet
+func (r *ResourceServer) register(ctx context.Context, register registerFunc) error {
+	if r.server == nil {
+		return fmt.Errorf("server is not running")
+	}
+	if err := register(ctx, r.plugin); err != nil {
+		return err
+	}
+	r.registered = true
+	return nil
+}
+
+// restart stops the server if needed, then starts and registers it again
+func (r *ResourceServer) restart(ctx context.Context, register registerFunc) error {
+	r.stop()
+	if err := r.start(); err != nil {
+		return err
+	}
+	if err := r.register(ctx, register); err != nil {
+		r.stop()
+		return fmt.Errorf("registration failed: %w", err)
+	}
+	return nil
+}
+
+// done receives when the running server exits, nil while stopped
+func (r *ResourceServer) done() <-chan error {
+	if r.server == nil {
+		return nil
+	}
+	return r.server.Done()
+}
+
+// stop shuts the server down and forgets the registration
+func (r *ResourceServer) stop() {
+	r.registered = false
+	if r.server == nil {
+		return
+	}
+	if err := r.server.Stop(); err != nil {
+		log.Printf("Error stopping server for %s: %v", r.Name(), err)
+	}
+	r.server = nil
+}
@@ -2,8 +2,15 @@ package statemachine
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"hailo-device-plugin/pkg/cdi"
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/monitor"
 	"hailo-device-plugin/pkg/plugin"
 )
 
@@ -42,43 +49,166 @@ func (s State) String() string {
 // Config holds configuration for the state machine
 type Config struct {
 	KubeletSocket string
-	PluginSocket  string
-	ResourceName  string
-	CdiDir        string
+	// PluginSocket and ResourceName describe the single resource used when
+	// Resources is empty
+	PluginSocket string
+	ResourceName string
+	// Resources are advertised by one plugin instance each
+	Resources      []Resource
+	CdiDir         string
+	SpecDirs       []string
+	AllocationMode plugin.AllocationMode
+	// Generator renders the spec used by the legacy allocation mode, nil uses the defaults
+	Generator *cdi.Generator
+	// Replicas time-slices every resource's devices into virtual devices,
+	// or sets the shared slots per device with Service
+	Replicas plugin.Replicas
+	// Service shares every resource's devices through hailort_service, optional
+	Service *plugin.HailortService
+	// ServiceProbeInterval is how often Service is checked for liveness
+	ServiceProbeInterval time.Duration
+
+	// RegisterRetries is the number of registration attempts per resource
+	RegisterRetries int
+	// Registration sets the registration timeouts, its socket defaults to KubeletSocket
+	Registration plugin.Registration
+	// ServerStartDelay gives new gRPC servers time to serve before registering
+	ServerStartDelay time.Duration
+	// RestartInterval is how often failed resource servers are restarted
+	RestartInterval time.Duration
+}
+
+const (
+	// DefaultRegisterRetries is the number of registration attempts per resource
+	DefaultRegisterRetries = 5
+	// DefaultServerStartDelay gives new gRPC servers time to serve before registering
+	DefaultServerStartDelay = 500 * time.Millisecond
+	// DefaultRestartInterval is how often a failed resource server is restarted
+	// while the other resources keep being served
+	DefaultRestartInterval = 30 * time.Second
+)
+
+// withDefaults returns a copy of c with the default of every unset field
+func (c Config) withDefaults() *Config {
+	if c.Registration.KubeletSocket == "" {
+		c.Registration.KubeletSocket = c.KubeletSocket
+	}
+	if c.ServiceProbeInterval <= 0 {
+		c.ServiceProbeInterval = plugin.DefaultServiceProbeInterval
+	}
+	if c.RegisterRetries <= 0 {
+		c.RegisterRetries = DefaultRegisterRetries
+	}
+	if c.ServerStartDelay <= 0 {
+		c.ServerStartDelay = DefaultServerStartDelay
+	}
+	if c.RestartInterval <= 0 {
+		c.RestartInterval = DefaultRestartInterval
+	}
+	return &c
+}
+
+// Resource is an extended resource served by its own plugin instance and socket
+type Resource struct {
+	Name   string
+	Socket string
+	// Match selects the devices of the resource, nil advertises every device
+	Match func(device.Device) bool
+}
+
+// ModelResources returns a resource per model, named <domain>/<model> after the
+// domain of resourceName and served next to socket, plus resourceName itself
+// for the devices of any other or unknown model
+func ModelResources(resourceName, socket string, models []string) []Resource {
+	domain, _, _ := strings.Cut(resourceName, "/")
+	dir := filepath.Dir(socket)
+
+	resources := make([]Resource, 0, len(models)+1)
+	for _, model := range models {
+		resources = append(resources, Resource{
+			Name:   domain + "/" + model,
+			Socket: filepath.Join(dir, "hailo-"+model+".sock"),
+			Match:  monitor.MatchModels(model),
+		})
+	}
+
+	modelled := monitor.MatchModels(models...)
+	resources = append(resources, Resource{
+		Name:   resourceName,
+		Socket: socket,
+		Match:  func(d device.Device) bool { return !modelled(d) },
+	})
+	return resources
 }
 
 // StateMachine manages the device plugin lifecycle through states
 type StateMachine struct {
-	currentState  State
-	plugin        *plugin.HailoDevicePlugin
-	server        *plugin.Server
-	watcher       *KubeletWatcher
-	config        *Config
-	ctx           context.Context
-	cancelFunc    context.CancelFunc
+	currentState State
+	servers      []*ResourceServer
+	register     registerFunc
+	watcher      *KubeletWatcher
+	config       *Config
+	ctx          context.Context
+	cancelFunc   context.CancelFunc
 }
 
 // New creates a new state machine
 func New(ctx context.Context, config *Config) *StateMachine {
 	smCtx, cancel := context.WithCancel(ctx)
 
-	return &StateMachine{
+	sm := &StateMachine{
 		currentState: StateWaitingForKubelet,
-		config:       config,
+		config:       config.withDefaults(),
 		ctx:          smCtx,
 		cancelFunc:   cancel,
 	}
+	sm.register = func(ctx context.Context, p *plugin.HailoDevicePlugin) error {
+		return plugin.RegisterWithKubelet(ctx, p, sm.config.RegisterRetries)
+	}
+	return sm
 }
 
 // Run executes the state machine main loop
-func (sm *StateMachine) Run(monitor interface{}) error {
+func (sm *StateMachine) Run(mon *monitor.ResourceMonitor) error {
 	log.Println("Starting Hailo device plugin state machine")
 
-	// Create device plugin instance
-	sm.plugin = &plugin.HailoDevicePlugin{
-		CdiDir:       sm.config.CdiDir,
-		SocketPath:   sm.config.PluginSocket,
-		ResourceName: sm.config.ResourceName,
+	resources := sm.config.Resources
+	if len(resources) == 0 {
+		resources = []Resource{{Name: sm.config.ResourceName, Socket: sm.config.PluginSocket}}
+	}
+
+	// Shared slots are only healthy while the service is alive
+	var devices plugin.DeviceSource = mon
+	if sm.config.Service != nil {
+		devices = monitor.RequireService(sm.ctx, mon, sm.config.Service.Probe, sm.config.ServiceProbeInterval)
+	}
+
+	// Create a device plugin instance per resource
+	names := make(map[string]bool, len(resources))
+	sockets := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		if names[r.Name] || sockets[r.Socket] {
+			return fmt.Errorf("resource %s on %s is configured twice", r.Name, r.Socket)
+		}
+		names[r.Name], sockets[r.Socket] = true, true
+
+		source := devices
+		if r.Match != nil {
+			source = monitor.Filter(sm.ctx, devices, r.Match)
+		}
+		sm.servers = append(sm.servers, NewResourceServer(&plugin.HailoDevicePlugin{
+			Monitor:        source,
+			CdiDir:         sm.config.CdiDir,
+			SpecDirs:       sm.config.SpecDirs,
+			SocketPath:     r.Socket,
+			ResourceName:   r.Name,
+			AllocationMode: sm.config.AllocationMode,
+			Generator:      sm.config.Generator,
+			Replicas:       sm.config.Replicas,
+			Service:        sm.config.Service,
+			Registration:   sm.config.Registration,
+		}))
+		log.Printf("Serving resource %s on %s", r.Name, r.Socket)
 	}
 
 	for {
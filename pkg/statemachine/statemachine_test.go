@@ -0,0 +1,166 @@
+package statemachine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"hailo-device-plugin/pkg/device"
+	"hailo-device-plugin/pkg/plugin"
+)
+
+func TestModelResources(t *testing.T) {
+	resources := ModelResources("hailo.ai/npu", "/var/lib/kubelet/device-plugins/hailo.sock",
+		[]string{device.ModelHailo8, device.ModelHailo8L})
+
+	expected := []struct{ name, socket string }{
+		{"hailo.ai/hailo8", "/var/lib/kubelet/device-plugins/hailo-hailo8.sock"},
+		{"hailo.ai/hailo8l", "/var/lib/kubelet/device-plugins/hailo-hailo8l.sock"},
+		{"hailo.ai/npu", "/var/lib/kubelet/device-plugins/hailo.sock"},
+	}
+	if len(resources) != len(expected) {
+		t.Fatalf("Expected %d resources, got %d", len(expected), len(resources))
+	}
+	for i, e := range expected {
+		if resources[i].Name != e.name || resources[i].Socket != e.socket {
+			t.Errorf("Resource %d: expected %s on %s, got %s on %s", i, e.name, e.socket, resources[i].Name, resources[i].Socket)
+		}
+	}
+
+	// Every device belongs to exactly one resource, unknown models to the catch-all
+	for _, model := range []string{device.ModelHailo8, device.ModelHailo8L, device.ModelHailo10H, ""} {
+		var owners []string
+		for _, r := range resources {
+			if r.Match(device.Device{Model: model}) {
+				owners = append(owners, r.Name)
+			}
+		}
+		if len(owners) != 1 {
+			t.Errorf("Model %q matched %v", model, owners)
+		}
+	}
+}
+
+func TestStateMachine_FailingResourceDoesNotBlockOthers(t *testing.T) {
+	dir := t.TempDir()
+	kubeletSocket := filepath.Join(dir, "kubelet.sock")
+	if err := os.WriteFile(kubeletSocket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	healthy := NewResourceServer(&plugin.HailoDevicePlugin{
+		ResourceName: "hailo.ai/hailo8",
+		SocketPath:   filepath.Join(dir, "hailo-hailo8.sock"),
+	})
+	// The socket directory is missing until the test creates it
+	failing := NewResourceServer(&plugin.HailoDevicePlugin{
+		ResourceName: "hailo.ai/hailo8l",
+		SocketPath:   filepath.Join(dir, "missing", "hailo-hailo8l.sock"),
+	})
+
+	var registered []string
+	sm := New(context.Background(), &Config{KubeletSocket: kubeletSocket})
+	sm.servers = []*ResourceServer{healthy, failing}
+	sm.register = func(ctx context.Context, p *plugin.HailoDevicePlugin) error {
+		registered = append(registered, p.ResourceName)
+		return nil
+	}
+	defer sm.handleCleanup()
+
+	if err := sm.handleInitializingServer(); err != nil {
+		t.Fatalf("Initialization failed although one server started: %v", err)
+	}
+	if err := sm.handleRegistering(); err != nil {
+		t.Fatalf("Registration failed although one server started: %v", err)
+	}
+	if !healthy.Ready() || failing.Ready() {
+		t.Fatalf("Expected only hailo8 to be ready, got hailo8=%v hailo8l=%v", healthy.Ready(), failing.Ready())
+	}
+
+	// The failing resource is restarted on its own once its socket can be created
+	if err := os.Mkdir(filepath.Join(dir, "missing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sm.restartServer(context.Background(), failing)
+	if !failing.Ready() || !healthy.Ready() {
+		t.Errorf("Expected both resources to be ready, got hailo8=%v hailo8l=%v", healthy.Ready(), failing.Ready())
+	}
+	if !reflect.DeepEqual(registered, []string{"hailo.ai/hailo8", "hailo.ai/hailo8l"}) {
+		t.Errorf("Unexpected registrations: %v", registered)
+	}
+}
+
+func TestStateMachine_AllResourcesFailing(t *testing.T) {
+	dir := t.TempDir()
+	kubeletSocket := filepath.Join(dir, "kubelet.sock")
+	if err := os.WriteFile(kubeletSocket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := New(context.Background(), &Config{KubeletSocket: kubeletSocket})
+	sm.servers = []*ResourceServer{NewResourceServer(&plugin.HailoDevicePlugin{
+		ResourceName: "hailo.ai/npu",
+		SocketPath:   filepath.Join(dir, "missing", "hailo.sock"),
+	})}
+	if err := sm.handleInitializingServer(); err == nil {
+		t.Error("Expected an error when no resource server starts")
+	}
+}
+
+func TestStateMachine_RunningWatchesSocketDuringRestart(t *testing.T) {
+	dir := t.TempDir()
+	kubeletSocket := filepath.Join(dir, "kubelet.sock")
+	if err := os.WriteFile(kubeletSocket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewResourceServer(&plugin.HailoDevicePlugin{
+		ResourceName: "hailo.ai/npu",
+		SocketPath:   filepath.Join(dir, "hailo.sock"),
+	})
+	sm := New(context.Background(), &Config{KubeletSocket: kubeletSocket, RestartInterval: 50 * time.Millisecond})
+	sm.servers = []*ResourceServer{rs}
+	defer sm.handleCleanup()
+
+	// The registration of the restarted server hangs until it is cancelled
+	blocked := make(chan struct{})
+	cancelled := make(chan struct{})
+	sm.register = func(ctx context.Context, p *plugin.HailoDevicePlugin) error {
+		close(blocked)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}
+
+	event := make(chan WatchEvent, 1)
+	go func() { event <- sm.handleRunning() }()
+
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stopped server to be restarted")
+	}
+	if err := os.Remove(kubeletSocket); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-event:
+		if e != EventSocketDeleted {
+			t.Errorf("Expected EventSocketDeleted, got %v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the socket deletion to be handled while registering")
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("Expected the registration in flight to be cancelled")
+	}
+	if rs.Ready() {
+		t.Error("Expected the cancelled restart to leave the server not ready")
+	}
+}
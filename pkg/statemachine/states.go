@@ -1,12 +1,12 @@
 package statemachine
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
-
-	"hailo-device-plugin/pkg/plugin"
 )
 
 // handleWaitingForKubelet waits for the kubelet socket to exist
@@ -51,35 +51,36 @@ func (sm *StateMachine) handleWaitingForKubelet() error {
 	}
 }
 
-// handleInitializingServer creates and starts the gRPC server
+// handleInitializingServer starts a gRPC server per resource. A resource
+// whose server fails is retried while running, only all failing is an error.
 func (sm *StateMachine) handleInitializingServer() error {
-	log.Println("Initializing gRPC server...")
+	log.Println("Initializing gRPC servers...")
 
 	// Verify kubelet socket still exists
 	if _, err := os.Stat(sm.config.KubeletSocket); os.IsNotExist(err) {
 		return fmt.Errorf("kubelet socket disappeared during initialization")
 	}
 
-	// Create server
-	server, err := plugin.NewServer(sm.plugin, sm.config.PluginSocket)
-	if err != nil {
-		return fmt.Errorf("failed to create server: %w", err)
+	started := 0
+	for _, rs := range sm.servers {
+		if err := rs.start(); err != nil {
+			log.Printf("Failed to start server for %s, will retry: %v", rs.Name(), err)
+			continue
+		}
+		started++
 	}
-	sm.server = server
-
-	// Start server (this launches a goroutine)
-	if err := sm.server.Start(); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	if started == 0 {
+		return fmt.Errorf("no resource server could be started")
 	}
 
-	// Give server a moment to initialize
-	time.Sleep(500 * time.Millisecond)
+	// Give servers a moment to initialize
+	time.Sleep(sm.config.ServerStartDelay)
 
-	log.Println("gRPC server initialized successfully")
+	log.Printf("%d of %d gRPC servers initialized successfully", started, len(sm.servers))
 	return nil
 }
 
-// handleRegistering registers the device plugin with kubelet
+// handleRegistering registers every running resource with kubelet
 func (sm *StateMachine) handleRegistering() error {
 	log.Println("Registering with kubelet...")
 
@@ -88,22 +89,34 @@ func (sm *StateMachine) handleRegistering() error {
 		return fmt.Errorf("kubelet socket disappeared before registration")
 	}
 
-	// Register with retry (max 5 attempts)
-	if err := plugin.RegisterWithKubelet(sm.plugin, 5); err != nil {
-		return fmt.Errorf("registration failed: %w", err)
+	registered := 0
+	for _, rs := range sm.servers {
+		if rs.done() == nil {
+			continue
+		}
+		if err := rs.register(sm.ctx, sm.register); err != nil {
+			log.Printf("Registration of %s failed, will retry: %v", rs.Name(), err)
+			rs.stop()
+			continue
+		}
+		log.Printf("Registered %s", rs.Name())
+		registered++
+	}
+	if registered == 0 {
+		return fmt.Errorf("no resource could be registered")
 	}
 
 	log.Println("Registration successful")
 	return nil
 }
 
-// handleRunning monitors the kubelet socket and waits for events
+// handleRunning monitors the kubelet socket and the resource servers. A
+// server that exits is restarted on its own, only a kubelet restart
+// re-registers every resource. Restarts run in the background so the
+// socket keeps being watched while a registration is retried.
 func (sm *StateMachine) handleRunning() WatchEvent {
 	log.Println("Entering RUNNING state, monitoring kubelet socket...")
 
-	// Create helper directories
-	ensureHelperDirectories()
-
 	// Create watcher for kubelet socket
 	watcher, err := NewKubeletWatcher(sm.ctx, sm.config.KubeletSocket)
 	if err != nil {
@@ -117,6 +130,35 @@ func (sm *StateMachine) handleRunning() WatchEvent {
 		return EventSocketDeleted // Trigger cleanup
 	}
 
+	exited := make(chan serverExit, len(sm.servers))
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, rs := range sm.servers {
+		watchServer(rs, exited, stop)
+	}
+
+	// Restarts in flight are cancelled and waited for before cleanup
+	// touches the servers
+	ctx, cancel := context.WithCancel(sm.ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	restarted := make(chan *ResourceServer, len(sm.servers))
+	restarting := make(map[*ResourceServer]bool, len(sm.servers))
+	restart := func(rs *ResourceServer) {
+		restarting[rs] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sm.restartServer(ctx, rs)
+			restarted <- rs
+		}()
+	}
+
+	retry := time.NewTicker(sm.config.RestartInterval)
+	defer retry.Stop()
+
 	// Monitor events
 	for {
 		select {
@@ -130,9 +172,22 @@ func (sm *StateMachine) handleRunning() WatchEvent {
 			log.Printf("Watcher error: %v", err)
 			// Don't exit on watcher errors, just log them
 
-		case serverErr := <-sm.server.Done():
-			log.Printf("gRPC server exited: %v", serverErr)
-			return EventSocketDeleted // Trigger cleanup
+		case exit := <-exited:
+			log.Printf("gRPC server for %s exited: %v", exit.server.Name(), exit.err)
+			exit.server.stop()
+			restart(exit.server)
+
+		case rs := <-restarted:
+			delete(restarting, rs)
+			watchServer(rs, exited, stop)
+
+		case <-retry.C:
+			for _, rs := range sm.servers {
+				if rs.Ready() || restarting[rs] {
+					continue
+				}
+				restart(rs)
+			}
 
 		case <-sm.ctx.Done():
 			log.Println("Shutdown signal received in RUNNING state")
@@ -141,16 +196,44 @@ func (sm *StateMachine) handleRunning() WatchEvent {
 	}
 }
 
-// handleCleanup stops the gRPC server and cleans up resources
+// serverExit reports a resource server whose gRPC server stopped serving
+type serverExit struct {
+	server *ResourceServer
+	err    error
+}
+
+// watchServer reports on exited once the running server of rs exits,
+// nothing is reported for a stopped server or after stop is closed
+func watchServer(rs *ResourceServer, exited chan<- serverExit, stop <-chan struct{}) {
+	done := rs.done()
+	if done == nil {
+		return
+	}
+	go func() {
+		select {
+		case err := <-done:
+			exited <- serverExit{server: rs, err: err}
+		case <-stop:
+		}
+	}()
+}
+
+// restartServer restarts and re-registers one resource, leaving the others alone
+func (sm *StateMachine) restartServer(ctx context.Context, rs *ResourceServer) {
+	if err := rs.restart(ctx, sm.register); err != nil {
+		log.Printf("Failed to restart %s, will retry in %v: %v", rs.Name(), sm.config.RestartInterval, err)
+		return
+	}
+	log.Printf("Restarted and registered %s", rs.Name())
+}
+
+// handleCleanup stops the gRPC servers and cleans up resources
 func (sm *StateMachine) handleCleanup() {
 	log.Println("Cleaning up resources...")
 
-	// Stop gRPC server
-	if sm.server != nil {
-		if err := sm.server.Stop(); err != nil {
-			log.Printf("Error stopping server: %v", err)
-		}
-		sm.server = nil
+	// Stop gRPC servers
+	for _, rs := range sm.servers {
+		rs.stop()
 	}
 
 	// Close watcher if exists
@@ -172,30 +255,3 @@ func (sm *StateMachine) handleShutdown() error {
 	log.Println("Device plugin shutdown complete")
 	return nil
 }
-
-// ensureHelperDirectories creates directories needed by CDI
-func ensureHelperDirectories() {
-	// Create empty chardev directory for sysfs isolation
-	if err := os.MkdirAll("/var/lib/hailo-cdi/empty-chardev", 0755); err != nil {
-		log.Printf("Warning: failed to create empty-chardev directory: %v", err)
-	}
-
-	// Create cleanup script
-	if err := ensureCleanupScript(); err != nil {
-		log.Printf("Warning: failed to create cleanup script: %v", err)
-	}
-}
-
-// ensureCleanupScript creates a cleanup script for removing files from empty-chardev
-func ensureCleanupScript() error {
-	scriptPath := "/var/lib/hailo-cdi/cleanup-empty-chardev.sh"
-	scriptContent := `#!/bin/sh
-# Cleanup script to remove all files from empty-chardev directory
-rm -rf /var/lib/hailo-cdi/empty-chardev/*
-exit 0
-`
-	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
-		return fmt.Errorf("failed to create cleanup script: %w", err)
-	}
-	return nil
-}